@@ -1,7 +1,10 @@
 package btawel
 
 import (
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -12,6 +15,33 @@ type TagInfo struct {
 	RowKey    bool
 	Qualifier bool
 	Column    string
+	// RowKeyIndex is a position of the field in a composite row key tagged as "rowkey=N",
+	// negative if N isn't a positive number.
+	RowKeyIndex int
+	// RowKeyDelimiter is a delimiter of a composite row key given as "delim=X", RowKeyDelimiter if empty.
+	RowKeyDelimiter string
+	// Reverse stores an integer part of a composite row key as its distance to the maximum value,
+	// so that the newer timestamps sort first.
+	Reverse bool
+	// TimeFormat is a format of a time.Time field, TimeFormatUnixNano if empty.
+	TimeFormat string
+	// Versions reads every version of the column into a slice of struct with Timestamp and Value,
+	// and writes each element as a version.
+	Versions bool
+	// TimestampField is a name of the field given as "ts=Name" holding the timestamp of the column,
+	// of type time.Time, *time.Time or bigtable.Timestamp.
+	TimestampField string
+	// Nullable deletes the column instead of setting it when the field is nil or a zero value.
+	Nullable bool
+	// Unknown is a field tagged as ",unknown" holding the cells of the columns not mapped to any field,
+	// of type map[string][]byte keyed by "family:qualifier".
+	Unknown bool
+	// Encoding is a name of the Codec given as "enc=name", or as "json" and "proto" for short.
+	Encoding string
+	// Family and ColumnQualifier are parts of Column in "family:qualifier" form.
+	// Family is empty when Column has no family prefix.
+	Family          string
+	ColumnQualifier string
 }
 
 const (
@@ -19,34 +49,144 @@ const (
 	BigtableTagName = "bigtable"
 	// ColumnQualifierDelimiter is a ":"
 	ColumnQualifierDelimiter = ":"
+	// ColumnQualifierWildcard is a "*", the suffix of the column qualifier of a map field
+	// holding every column of a family which has the prefix
+	ColumnQualifierWildcard = "*"
 )
 
+// Formats of a time.Time field given as a tag option.
+const (
+	// TimeFormatUnixNano stores Unix time in nanoseconds as a big-endian int64.
+	TimeFormatUnixNano = "unixnano"
+	// TimeFormatUnixMilli stores Unix time in milliseconds as a big-endian int64.
+	TimeFormatUnixMilli = "unixmilli"
+	// TimeFormatRFC3339 stores time as a string in RFC 3339 format with nanoseconds.
+	TimeFormatRFC3339 = "rfc3339"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+
+	unknownType = reflect.TypeOf(map[string][]byte{})
+
+	// numberTypes are the types a number of each kind is stored as.
+	numberTypes = map[reflect.Kind]reflect.Type{
+		reflect.Int:     reflect.TypeOf(int64(0)),
+		reflect.Int8:    reflect.TypeOf(int8(0)),
+		reflect.Int16:   reflect.TypeOf(int16(0)),
+		reflect.Int32:   reflect.TypeOf(int32(0)),
+		reflect.Int64:   reflect.TypeOf(int64(0)),
+		reflect.Uint:    reflect.TypeOf(uint64(0)),
+		reflect.Uint8:   reflect.TypeOf(uint8(0)),
+		reflect.Uint16:  reflect.TypeOf(uint16(0)),
+		reflect.Uint32:  reflect.TypeOf(uint32(0)),
+		reflect.Uint64:  reflect.TypeOf(uint64(0)),
+		reflect.Float32: reflect.TypeOf(float32(0)),
+		reflect.Float64: reflect.TypeOf(float64(0)),
+	}
+)
+
+// RowKeyDelimiter separates parts of a composite row key unless a part is tagged with "delim=X".
+const RowKeyDelimiter = "#"
+
 // GetBigtableTagInfo gets TagInfo by a field tag.
+// The first field of the tag separated by commas is the column, and the others are the options,
+// so that a column can be named like an option. "-", "rowkey" and "qualifier" alone are the options.
 func GetBigtableTagInfo(tag string) (ti TagInfo) {
 
-	ss := strings.FieldsFunc(tag, func(c rune) bool {
-		return c == ',' || unicode.IsSpace(c)
-	})
+	fs := strings.SplitN(tag, ",", 2)
+	column := strings.Fields(fs[0])
 
-	for i := range ss {
-		if ss[i] == "-" {
+	var ss []string
+	if len(column) > 0 {
+		ss = column[1:]
+	}
+	if len(fs) > 1 {
+		ss = append(ss, strings.FieldsFunc(fs[1], func(c rune) bool {
+			return c == ',' || unicode.IsSpace(c)
+		})...)
+	}
+
+	if len(column) > 0 {
+		switch {
+		case column[0] == "-":
 			ti.Ignore = true
 			return
+		case (column[0] == "rowkey" || column[0] == "qualifier") && len(column) == 1 && len(fs) == 1:
+			ss = column
+		default:
+			ti.Column = column[0]
 		}
-		if ss[i] == "rowkey" && len(ss) == 1 {
+	}
+
+	for i := range ss {
+		switch {
+
+		case ss[i] == "rowkey":
 			ti.RowKey = true
-			continue
-		}
-		if ss[i] == "qualifier" && len(ss) == 1 {
+
+		case strings.HasPrefix(ss[i], "rowkey="):
+			ti.RowKey = true
+			n, err := strconv.Atoi(strings.TrimPrefix(ss[i], "rowkey="))
+			if err != nil || n <= 0 {
+				n = -1
+			}
+			ti.RowKeyIndex = n
+
+		case strings.HasPrefix(ss[i], "delim="):
+			ti.RowKeyDelimiter = strings.TrimPrefix(ss[i], "delim=")
+
+		case strings.HasPrefix(ss[i], "enc="):
+			ti.Encoding = strings.TrimPrefix(ss[i], "enc=")
+
+		case ss[i] == "json" || ss[i] == "proto":
+			ti.Encoding = ss[i]
+
+		case strings.HasPrefix(ss[i], "ts="):
+			ti.TimestampField = strings.TrimPrefix(ss[i], "ts=")
+
+		case ss[i] == "versions":
+			ti.Versions = true
+
+		case ss[i] == "reverse":
+			ti.Reverse = true
+
+		case ss[i] == TimeFormatUnixNano || ss[i] == TimeFormatUnixMilli || ss[i] == TimeFormatRFC3339:
+			ti.TimeFormat = ss[i]
+
+		case ss[i] == "unknown" && ti.Column == "":
+			ti.Unknown = true
+
+		case ss[i] == "qualifier":
 			ti.Qualifier = true
-			continue
-		}
-		if ss[i] == "omitempty" && len(ss) > 1 {
+
+		case ss[i] == "nullable":
+			ti.Nullable = true
+
+		case ss[i] == "omitempty":
 			ti.Omitempty = true
-			continue
 		}
-		ti.Column = ss[i]
+	}
+
+	ti.ColumnQualifier = ti.Column
+	if n := strings.Index(ti.Column, ColumnQualifierDelimiter); n >= 0 {
+		ti.Family, ti.ColumnQualifier = ti.Column[:n], ti.Column[n+1:]
 	}
 
 	return
 }
+
+// isNestedType reports whether the fields of a struct field of type t tagged as ti are columns.
+func isNestedType(t reflect.Type, ti TagInfo) bool {
+	return t.Kind() == reflect.Struct && !isValueType(t) && ti.Encoding == ""
+}
+
+// qualifierPrefix returns the prefix of the column qualifiers of a map field tagged as "family:prefix*".
+func (ti TagInfo) qualifierPrefix() (string, bool) {
+
+	if !strings.HasSuffix(ti.ColumnQualifier, ColumnQualifierWildcard) {
+		return "", false
+	}
+
+	return strings.TrimSuffix(ti.ColumnQualifier, ColumnQualifierWildcard), true
+}
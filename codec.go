@@ -0,0 +1,399 @@
+package btawel
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec encodes and decodes a field value of the tag option "enc=name".
+type Codec interface {
+	// Encode encodes v into a cell value.
+	Encode(v interface{}) ([]byte, error)
+	// Decode decodes a cell value into v, which is a pointer to a field value.
+	Decode(b []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"string": stringCodec{},
+		"int64":  int64Codec{},
+		"varint": varintCodec{},
+		"json":   jsonCodec{},
+		"proto":  protoCodec{},
+	}
+)
+
+// RegisterCodec registers a Codec by name for the tag option "enc=name".
+// "string", "int64", "varint", "json" and "proto" are registered by default.
+func RegisterCodec(name string, c Codec) {
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[name] = c
+}
+
+func lookupCodec(name string) (c Codec, err error) {
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		err = fmt.Errorf("cloth: unknown encoding %q", name)
+	}
+
+	return
+}
+
+func encodeWith(name string, v reflect.Value) (b []byte, err error) {
+
+	c, err := lookupCodec(name)
+	if err != nil {
+		return
+	}
+
+	return c.Encode(v.Interface())
+}
+
+func decodeWith(name string, v reflect.Value, b []byte) (err error) {
+
+	c, err := lookupCodec(name)
+	if err != nil {
+		return
+	}
+
+	return c.Decode(b, v.Addr().Interface())
+}
+
+// BigtableMarshaler is the interface implemented by types that can marshal themselves into a cell value.
+type BigtableMarshaler interface {
+	MarshalBigtable() ([]byte, error)
+}
+
+// BigtableUnmarshaler is the interface implemented by types that can unmarshal a cell value of themselves.
+type BigtableUnmarshaler interface {
+	UnmarshalBigtable([]byte) error
+}
+
+var (
+	bigtableMarshalerType   = reflect.TypeOf((*BigtableMarshaler)(nil)).Elem()
+	bigtableUnmarshalerType = reflect.TypeOf((*BigtableUnmarshaler)(nil)).Elem()
+	binaryMarshalerType     = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType   = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	textMarshalerType       = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType     = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	protoMessageType        = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// isValueType reports whether t is stored in a cell by a marshaler or as time,
+// instead of by its kind or its fields.
+func isValueType(t reflect.Type) bool {
+
+	if t == timeType {
+		return true
+	}
+
+	for _, it := range []reflect.Type{
+		bigtableMarshalerType, bigtableUnmarshalerType,
+		binaryMarshalerType, binaryUnmarshalerType,
+		textMarshalerType, textUnmarshalerType,
+	} {
+		if t.Implements(it) || reflect.PtrTo(t).Implements(it) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// marshalerOf returns v or a pointer to v which implements the interface type it.
+func marshalerOf(v reflect.Value, it reflect.Type) (interface{}, bool) {
+
+	if v.Type().Implements(it) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil, false
+		}
+		return v.Interface(), true
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(it) {
+		if v.CanAddr() {
+			return v.Addr().Interface(), true
+		}
+		// a method with a pointer receiver is called on a copy
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface(), true
+	}
+
+	return nil, false
+}
+
+// marshal marshals v if it implements BigtableMarshaler, encoding.BinaryMarshaler or encoding.TextMarshaler.
+// time.Time is encoded by its TimeFormat instead.
+func marshal(v reflect.Value) (b []byte, ok bool, err error) {
+
+	if m, ok := marshalerOf(v, bigtableMarshalerType); ok {
+		b, err = m.(BigtableMarshaler).MarshalBigtable()
+		return b, true, err
+	}
+
+	if v.Type() == timeType {
+		return
+	}
+
+	if m, ok := marshalerOf(v, binaryMarshalerType); ok {
+		b, err = m.(encoding.BinaryMarshaler).MarshalBinary()
+		return b, true, err
+	}
+
+	if m, ok := marshalerOf(v, textMarshalerType); ok {
+		b, err = m.(encoding.TextMarshaler).MarshalText()
+		return b, true, err
+	}
+
+	return
+}
+
+// unmarshal unmarshals b into v if v implements BigtableUnmarshaler, encoding.BinaryUnmarshaler or encoding.TextUnmarshaler.
+// v should be addressable. time.Time is decoded by its TimeFormat instead.
+func unmarshal(v reflect.Value, b []byte) (ok bool, err error) {
+
+	if !v.CanAddr() {
+		return
+	}
+
+	if u, ok := marshalerOf(v, bigtableUnmarshalerType); ok {
+		return true, u.(BigtableUnmarshaler).UnmarshalBigtable(b)
+	}
+
+	if v.Type() == timeType {
+		return
+	}
+
+	if u, ok := marshalerOf(v, binaryUnmarshalerType); ok {
+		return true, u.(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+
+	if u, ok := marshalerOf(v, textUnmarshalerType); ok {
+		return true, u.(encoding.TextUnmarshaler).UnmarshalText(b)
+	}
+
+	return
+}
+
+// stringCodec stores strings, booleans and numbers as decimal strings.
+type stringCodec struct{}
+
+func (stringCodec) Encode(i interface{}) ([]byte, error) {
+
+	v := reflect.ValueOf(i)
+
+	switch v.Kind() {
+
+	case reflect.String:
+		return []byte(v.String()), nil
+
+	case reflect.Bool:
+		return strconv.AppendBool(nil, v.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, v.Int(), 10), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(nil, v.Uint(), 10), nil
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+
+	return nil, fmt.Errorf("cloth: unsupported type of string encoding. %v", v.Kind())
+}
+
+func (stringCodec) Decode(b []byte, i interface{}) (err error) {
+
+	v := reflect.ValueOf(i).Elem()
+	s := string(b)
+
+	switch v.Kind() {
+
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		var x bool
+		x, err = strconv.ParseBool(s)
+		v.SetBool(x)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var x int64
+		x, err = strconv.ParseInt(s, 10, v.Type().Bits())
+		v.SetInt(x)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var x uint64
+		x, err = strconv.ParseUint(s, 10, v.Type().Bits())
+		v.SetUint(x)
+
+	case reflect.Float32, reflect.Float64:
+		var x float64
+		x, err = strconv.ParseFloat(s, v.Type().Bits())
+		v.SetFloat(x)
+
+	default:
+		err = fmt.Errorf("cloth: unsupported type of string encoding. %v", v.Kind())
+	}
+
+	return
+}
+
+// int64Codec stores integers as a big-endian int64,
+// which is the format of ReadModifyWrite.Increment.
+type int64Codec struct{}
+
+func (int64Codec) Encode(i interface{}) ([]byte, error) {
+
+	v := reflect.ValueOf(i)
+	b := make([]byte, 8)
+
+	switch v.Kind() {
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.BigEndian.PutUint64(b, uint64(v.Int()))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		binary.BigEndian.PutUint64(b, v.Uint())
+
+	default:
+		return nil, fmt.Errorf("cloth: unsupported type of int64 encoding. %v", v.Kind())
+	}
+
+	return b, nil
+}
+
+func (int64Codec) Decode(b []byte, i interface{}) error {
+
+	if len(b) != 8 {
+		return fmt.Errorf("cloth: int64 encoding should be 8 bytes, got %d", len(b))
+	}
+
+	v := reflect.ValueOf(i).Elem()
+	n := int64(binary.BigEndian.Uint64(b))
+
+	switch v.Kind() {
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return fmt.Errorf("cloth: %d overflows %v", n, v.Type())
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("cloth: %d overflows %v", n, v.Type())
+		}
+		v.SetUint(uint64(n))
+
+	default:
+		return fmt.Errorf("cloth: unsupported type of int64 encoding. %v", v.Kind())
+	}
+
+	return nil
+}
+
+// varintCodec stores integers as varints of encoding/binary.
+type varintCodec struct{}
+
+func (varintCodec) Encode(i interface{}) ([]byte, error) {
+
+	v := reflect.ValueOf(i)
+	b := make([]byte, binary.MaxVarintLen64)
+
+	switch v.Kind() {
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return b[:binary.PutVarint(b, v.Int())], nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return b[:binary.PutUvarint(b, v.Uint())], nil
+	}
+
+	return nil, fmt.Errorf("cloth: unsupported type of varint encoding. %v", v.Kind())
+}
+
+func (varintCodec) Decode(b []byte, i interface{}) error {
+
+	v := reflect.ValueOf(i).Elem()
+
+	switch v.Kind() {
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, l := binary.Varint(b)
+		if l <= 0 || v.OverflowInt(n) {
+			return fmt.Errorf("cloth: invalid varint of %v", v.Type())
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, l := binary.Uvarint(b)
+		if l <= 0 || v.OverflowUint(n) {
+			return fmt.Errorf("cloth: invalid varint of %v", v.Type())
+		}
+		v.SetUint(n)
+
+	default:
+		return fmt.Errorf("cloth: unsupported type of varint encoding. %v", v.Kind())
+	}
+
+	return nil
+}
+
+// jsonCodec stores values as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(i interface{}) ([]byte, error) {
+	return json.Marshal(i)
+}
+
+func (jsonCodec) Decode(b []byte, i interface{}) error {
+	return json.Unmarshal(b, i)
+}
+
+// protoCodec stores proto.Message values in the protobuf wire format.
+type protoCodec struct{}
+
+func (protoCodec) Encode(i interface{}) ([]byte, error) {
+
+	m, ok := i.(proto.Message)
+	if !ok {
+		// a message struct of a field value
+		if p, ok := marshalerOf(reflect.ValueOf(i), protoMessageType); ok {
+			m = p.(proto.Message)
+		}
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("cloth: %T is not proto.Message", i)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Decode(b []byte, i interface{}) error {
+
+	m, ok := i.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cloth: %T is not proto.Message", i)
+	}
+
+	return proto.Unmarshal(b, m)
+}
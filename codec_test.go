@@ -0,0 +1,383 @@
+package btawel_test
+
+import (
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+)
+
+// Money implements BigtableMarshaler and BigtableUnmarshaler.
+type Money struct {
+	Currency string
+	Amount   int64
+}
+
+func (m Money) MarshalBigtable() ([]byte, error) {
+	return []byte(fmt.Sprintf("%s %d", m.Currency, m.Amount)), nil
+}
+
+func (m *Money) UnmarshalBigtable(b []byte) (err error) {
+	ss := strings.SplitN(string(b), " ", 2)
+	if len(ss) != 2 {
+		return fmt.Errorf("invalid money %q", b)
+	}
+	m.Currency = ss[0]
+	m.Amount, err = strconv.ParseInt(ss[1], 10, 64)
+	return
+}
+
+// UUID implements encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+type UUID [4]byte
+
+func (u UUID) MarshalBinary() ([]byte, error) {
+	return u[:], nil
+}
+
+func (u *UUID) UnmarshalBinary(b []byte) error {
+	copy(u[:], b)
+	return nil
+}
+
+// Status implements encoding.TextMarshaler and encoding.TextUnmarshaler.
+type Status int
+
+const (
+	Active Status = iota + 1
+	Suspended
+)
+
+func (s Status) MarshalText() ([]byte, error) {
+	switch s {
+	case Active:
+		return []byte("active"), nil
+	case Suspended:
+		return []byte("suspended"), nil
+	}
+	return nil, fmt.Errorf("invalid status %d", s)
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "active":
+		*s = Active
+	case "suspended":
+		*s = Suspended
+	default:
+		return fmt.Errorf("invalid status %q", b)
+	}
+	return nil
+}
+
+type Account struct {
+	ID      string `bigtable:",rowkey"`
+	Balance Money  `bigtable:"fc:balance"`
+	Limit   *Money `bigtable:"fc:limit, omitempty"`
+	Token   UUID   `bigtable:"fc:token"`
+	Status  Status `bigtable:"fc:status"`
+}
+
+func TestMarshaler(t *testing.T) {
+
+	a := Account{
+		ID:      "john",
+		Balance: Money{Currency: "IDR", Amount: 15000},
+		Token:   UUID{0xde, 0xad, 0xbe, 0xef},
+		Status:  Suspended,
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &a)
+	require.NoError(t, err)
+
+	cs := setCells(t, m)
+	require.Equal(t, map[string][]byte{
+		"fc:balance": []byte("IDR 15000"),
+		"fc:token":   []byte{0xde, 0xad, 0xbe, 0xef},
+		"fc:status":  []byte("suspended"),
+	}, cs)
+
+	row := bigtable.Row{"fc": []bigtable.ReadItem{
+		bigtable.ReadItem{Row: "john", Column: "fc:balance", Value: cs["fc:balance"]},
+		bigtable.ReadItem{Row: "john", Column: "fc:limit", Value: []byte("USD 100")},
+		bigtable.ReadItem{Row: "john", Column: "fc:token", Value: cs["fc:token"]},
+		bigtable.ReadItem{Row: "john", Column: "fc:status", Value: cs["fc:status"]},
+	}}
+
+	var got Account
+	require.NoError(t, btawel.ReadRow(row, &got))
+
+	a.Limit = &Money{Currency: "USD", Amount: 100}
+	require.Equal(t, a, got)
+
+	t.Run("Error of marshaler", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &Account{Status: Status(3)})
+		require.Error(t, err)
+	})
+
+	t.Run("Error of unmarshaler", func(t *testing.T) {
+		var got Account
+		err := btawel.ReadItems([]bigtable.ReadItem{
+			bigtable.ReadItem{Row: "john", Column: "fc:balance", Value: []byte("IDR")},
+		}, &got)
+		require.Error(t, err)
+	})
+
+	t.Run("TextMarshaler in standard library", func(t *testing.T) {
+		var s struct {
+			Hash hexBytes `bigtable:"fc:hash"`
+		}
+		err := btawel.ReadItems([]bigtable.ReadItem{
+			bigtable.ReadItem{Row: "john", Column: "fc:hash", Value: []byte("cafe")},
+		}, &s)
+		require.NoError(t, err)
+		require.Equal(t, hexBytes{0xca, 0xfe}, s.Hash)
+	})
+
+	t.Run("Error if interface is nil", func(t *testing.T) {
+		var s struct {
+			Status interface {
+				encoding.TextMarshaler
+				encoding.TextUnmarshaler
+			} `bigtable:"fc:status"`
+		}
+
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+		require.Error(t, err)
+
+		err = btawel.ReadItems([]bigtable.ReadItem{
+			bigtable.ReadItem{Row: "john", Column: "fc:status", Value: []byte("active")},
+		}, &s)
+		require.Error(t, err)
+
+		st := Active
+		s.Status = &st
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"fc:status": []byte("active")}, setCells(t, m))
+	})
+}
+
+// hexBytes implements encoding.TextUnmarshaler on a slice type.
+type hexBytes []byte
+
+func (h *hexBytes) UnmarshalText(b []byte) (err error) {
+	*h, err = hex.DecodeString(string(b))
+	return
+}
+
+type Counter struct {
+	ID      string  `bigtable:",rowkey"`
+	Views   int64   `bigtable:"fc:views, enc=int64"`
+	Likes   int32   `bigtable:"fc:likes, enc=string"`
+	Rate    float64 `bigtable:"fc:rate, enc=string"`
+	Enabled bool    `bigtable:"fc:enabled, enc=string"`
+	Shares  uint16  `bigtable:"fc:shares, enc=varint"`
+	Delta   int     `bigtable:"fc:delta, enc=varint"`
+	Tags    []int   `bigtable:"fc:tags, enc=json"`
+	Note    *string `bigtable:"fc:note, enc=json, omitempty"`
+}
+
+func TestCodec(t *testing.T) {
+
+	c := Counter{
+		ID:      "post",
+		Views:   1000,
+		Likes:   -42,
+		Rate:    0.25,
+		Enabled: true,
+		Shares:  300,
+		Delta:   -1,
+		Tags:    []int{1, 2},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &c)
+	require.NoError(t, err)
+
+	cs := setCells(t, m)
+	require.Equal(t, map[string][]byte{
+		"fc:views":   []byte{0, 0, 0, 0, 0, 0, 0x03, 0xe8},
+		"fc:likes":   []byte("-42"),
+		"fc:rate":    []byte("0.25"),
+		"fc:enabled": []byte("true"),
+		"fc:shares":  []byte{0xac, 0x02},
+		"fc:delta":   []byte{0x01},
+		"fc:tags":    []byte("[1,2]"),
+	}, cs)
+
+	var ris []bigtable.ReadItem
+	for col, v := range cs {
+		ris = append(ris, bigtable.ReadItem{Row: "post", Column: col, Value: v})
+	}
+	ris = append(ris, bigtable.ReadItem{Row: "post", Column: "fc:note", Value: []byte(`"hello"`)})
+
+	var got Counter
+	require.NoError(t, btawel.ReadItems(ris, &got))
+	require.Equal(t, "hello", *got.Note)
+	got.Note = nil
+	require.Equal(t, c, got)
+
+	t.Run("Error if encoding is unknown", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			A int `bigtable:"a, enc=unknown"`
+		}{})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if type is unsupported", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			A string `bigtable:"a, enc=int64"`
+		}{})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if int64 isn't 8 bytes", func(t *testing.T) {
+		var got Counter
+		err := btawel.ReadItems([]bigtable.ReadItem{
+			bigtable.ReadItem{Row: "post", Column: "fc:views", Value: []byte{1}},
+		}, &got)
+		require.Error(t, err)
+	})
+
+	t.Run("Error if string isn't a number", func(t *testing.T) {
+		var got Counter
+		err := btawel.ReadItems([]bigtable.ReadItem{
+			bigtable.ReadItem{Row: "post", Column: "fc:likes", Value: []byte("many")},
+		}, &got)
+		require.Error(t, err)
+	})
+}
+
+func TestCodecReadModifyWrite(t *testing.T) {
+
+	tbl, closer := newTestTable(t, "fc")
+	defer closer()
+
+	ctx := context.Background()
+	table := btawel.NewTable(tbl, "")
+
+	require.NoError(t, table.Put(ctx, &Counter{ID: "post", Views: 10}))
+
+	rmw := bigtable.NewReadModifyWrite()
+	rmw.Increment("fc", "views", 5)
+	_, err := tbl.ApplyReadModifyWrite(ctx, "post", rmw)
+	require.NoError(t, err)
+
+	var got Counter
+	require.NoError(t, table.Get(ctx, "post", &got))
+	require.Equal(t, int64(15), got.Views)
+}
+
+// upperCodec stores strings in upper case.
+type upperCodec struct{}
+
+func (upperCodec) Encode(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(string))), nil
+}
+
+func (upperCodec) Decode(b []byte, v interface{}) error {
+	*(v.(*string)) = strings.ToLower(string(b))
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+
+	btawel.RegisterCodec("upper", upperCodec{})
+
+	s := struct {
+		Code string `bigtable:"fc:code, enc=upper"`
+	}{"idr"}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+	require.NoError(t, err)
+	require.Equal(t, []byte("IDR"), setCells(t, m)["fc:code"])
+
+	s.Code = ""
+	err = btawel.ReadItems([]bigtable.ReadItem{
+		bigtable.ReadItem{Row: "key", Column: "fc:code", Value: []byte("USD")},
+	}, &s)
+	require.NoError(t, err)
+	require.Equal(t, "usd", s.Code)
+}
+
+type Preference struct {
+	Language string
+	Currency string
+}
+
+type Member struct {
+	ID         string                `bigtable:",rowkey"`
+	Tags       []string              `bigtable:"fc:tags, json"`
+	Scores     map[string]int        `bigtable:"fc:scores, json"`
+	Preference Preference            `bigtable:"fc:preference, json"`
+	Nickname   *wrappers.StringValue `bigtable:"fc:nickname, proto"`
+	LastSeen   timestamp.Timestamp   `bigtable:"fc:lastSeen, proto"`
+}
+
+func TestJSONAndProto(t *testing.T) {
+
+	p := Member{
+		ID:         "john",
+		Tags:       []string{"a", "b"},
+		Scores:     map[string]int{"math": 90},
+		Preference: Preference{Language: "id", Currency: "IDR"},
+		Nickname:   &wrappers.StringValue{Value: "jo"},
+		LastSeen:   timestamp.Timestamp{Seconds: 1538352000},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &p)
+	require.NoError(t, err)
+
+	nickname, err := proto.Marshal(p.Nickname)
+	require.NoError(t, err)
+	lastSeen, err := proto.Marshal(&p.LastSeen)
+	require.NoError(t, err)
+
+	cs := setCells(t, m)
+	require.Equal(t, map[string][]byte{
+		"fc:tags":       []byte(`["a","b"]`),
+		"fc:scores":     []byte(`{"math":90}`),
+		"fc:preference": []byte(`{"Language":"id","Currency":"IDR"}`),
+		"fc:nickname":   nickname,
+		"fc:lastSeen":   lastSeen,
+	}, cs)
+
+	var ris []bigtable.ReadItem
+	for col, v := range cs {
+		ris = append(ris, bigtable.ReadItem{Row: "john", Column: col, Value: v})
+	}
+
+	var got Member
+	require.NoError(t, btawel.ReadRow(bigtable.Row{"fc": ris}, &got))
+	require.Equal(t, p.Tags, got.Tags)
+	require.Equal(t, p.Scores, got.Scores)
+	require.Equal(t, p.Preference, got.Preference)
+	require.True(t, proto.Equal(p.Nickname, got.Nickname))
+	require.True(t, proto.Equal(&p.LastSeen, &got.LastSeen))
+
+	t.Run("Error if proto isn't proto.Message", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			A string `bigtable:"a, proto"`
+		}{"a"})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if json is invalid", func(t *testing.T) {
+		var got Member
+		err := btawel.ReadItems([]bigtable.ReadItem{
+			bigtable.ReadItem{Row: "john", Column: "fc:tags", Value: []byte("[")},
+		}, &got)
+		require.Error(t, err)
+	})
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
-	"github.com/fatih/structs"
 	"github.com/osamingo/boolconv"
 
 	"cloud.google.com/go/bigtable"
@@ -15,6 +15,23 @@ import (
 
 // ReadRow converts bigtable.Row into a struct
 func ReadRow(row bigtable.Row, s interface{}) (err error) {
+	return readRow(row, "", s, DecodeOptions{})
+}
+
+// ReadRowWithOptions converts bigtable.Row into a struct by DecodeOptions.
+// The cells of the columns not mapped to any field are set into the field tagged as ",unknown" if any.
+func ReadRowWithOptions(row bigtable.Row, s interface{}, opts DecodeOptions) (err error) {
+	return readRow(row, "", s, opts)
+}
+
+// readRow converts bigtable.Row into a struct,
+// family is used for the fields tagged without a family.
+func readRow(row bigtable.Row, family string, s interface{}, opts DecodeOptions) (err error) {
+
+	v, p, err := structPtrOf(s)
+	if err != nil {
+		return
+	}
 
 	// create a map of bigtable readItem
 	// to make data lookup faster
@@ -24,55 +41,143 @@ func ReadRow(row bigtable.Row, s interface{}) (err error) {
 
 	for _, v := range items {
 		for _, item := range v {
-			rowMap[item.Column] = item
+			// the newest version of a column
+			if old, ok := rowMap[item.Column]; !ok || item.Timestamp > old.Timestamp {
+				rowMap[item.Column] = item
+			}
 		}
 	}
 
-	st := structs.New(s)
-	fs := st.Fields()
+	d := &decoder{key: row.Key(), opts: opts, used: map[string]bool{}}
 
-	if err = parseVal(row, rowMap, fs); err != nil {
+	if err = d.check("", nil, "", nil, readRowKeyParts(row.Key(), v, p)); err != nil {
 		return
 	}
-	return
-}
 
-// recursively parse data for all fields of struct based on the tag the field has
-func parseVal(row bigtable.Row, rowMap map[string]bigtable.ReadItem, fs []*structs.Field) (err error) {
+	if err = parseVal(row, family, rowMap, v, p, d); err != nil {
+		return
+	}
 
-	if len(fs) == 0 {
+	if err = d.err(); err != nil {
 		return
 	}
 
-	for _, f := range fs {
+	var ris []bigtable.ReadItem
+	for _, items := range row {
+		ris = append(ris, items...)
+	}
+
+	err = d.readUnknown(ris, v, p)
+
+	return
+}
+
+// parse data for all fields of struct based on the tag the field has
+func parseVal(row bigtable.Row, family string, rowMap map[string]bigtable.ReadItem, v reflect.Value, p *structPlan, d *decoder) (err error) {
 
-		t := f.Tag(BigtableTagName)
+	for _, f := range p.fields {
+
+		ti := f.ti
 
-		ti := GetBigtableTagInfo(t)
 		if ti.RowKey {
-			if err = setValue(f, []byte(row.Key())); err != nil {
+			if ti.RowKeyIndex > 0 {
+				continue
+			}
+			key := []bigtable.ReadItem{{Row: row.Key(), Value: []byte(row.Key())}}
+			if err = d.decode(f, "", key, func() error {
+				return setValue(allocField(v, f.index), ti, []byte(row.Key()))
+			}); err != nil {
 				return
 			}
 			continue
 		}
 
+		if ti.Unknown {
+			continue
+		}
+
+		col := ti.Column
+		if ti.Family == "" && family != "" {
+			col = family + ColumnQualifierDelimiter + ti.Column
+		}
+
+		if ti.Versions {
+			fm, _ := splitColumn(col)
 
-		if f.Kind() == reflect.Struct {
-			parseVal(row, rowMap, f.Fields())
+			var ris []bigtable.ReadItem
+			for _, item := range row[fm] {
+				if item.Column == col {
+					ris = append(ris, item)
+				}
+			}
+
+			if err = d.decode(f, col, ris, func() error {
+				return setVersionsValue(fieldFor(v, f, ris), ti, ris)
+			}); err != nil {
+				return
+			}
+		} else if f.isPrefix {
+			fm := ti.Family
+			if fm == "" {
+				fm = family
+			}
+
+			var ris []bigtable.ReadItem
+			for k, items := range row {
+				if fm != "" && k != fm {
+					continue
+				}
+				for _, item := range items {
+					if _, q := splitColumn(item.Column); strings.HasPrefix(q, f.prefix) {
+						ris = append(ris, item)
+					}
+				}
+			}
+
+			ris = latestItems(ris)
+			if err = d.decode(f, col, ris, func() error {
+				return setMapValue(fieldFor(v, f, ris), f, ris)
+			}); err != nil {
+				return
+			}
 		} else {
-			if rowMap[ti.Column].Value == nil {
+			item, ok := rowMap[col]
+			if ok {
+				d.used[col] = true
+			}
+
+			if item.Value == nil {
 				continue
 			}
 
-			if err = setValue(f, rowMap[ti.Column].Value); err != nil {
+			if err = d.decode(f, col, []bigtable.ReadItem{item}, func() error {
+				return setValue(allocField(v, f.index), ti, item.Value)
+			}); err != nil {
 				return
 			}
-			continue
+
+			if f.ts != nil {
+				if err = setTimestamp(allocField(v, f.ts.index), item.Timestamp); err != nil {
+					return
+				}
+			}
 		}
 	}
 	return
 }
 
+// readRowKeyParts sets the parts of a composite row key into the fields tagged as "rowkey=N".
+func readRowKeyParts(key string, v reflect.Value, p *structPlan) (err error) {
+
+	if p.rowKeyErr != nil {
+		return p.rowKeyErr
+	}
+
+	err = decodeRowKey(key, v, p.rowKeyParts, p.rowKeyDelimiter)
+
+	return
+}
+
 // ReadColumnQualifier returns column qualifiers.
 func ReadColumnQualifier(ris []bigtable.ReadItem) (cqs []string) {
 
@@ -84,245 +189,258 @@ func ReadColumnQualifier(ris []bigtable.ReadItem) (cqs []string) {
 	return
 }
 
-// ReadItems converts Mutation into Struct.
+// ReadItems converts Mutation into Struct, nested structs included.
 func ReadItems(ris []bigtable.ReadItem, s interface{}) (err error) {
+	return ReadItemsWithOptions(ris, s, DecodeOptions{})
+}
+
+// ReadItemsWithOptions converts Mutation into Struct by DecodeOptions.
+func ReadItemsWithOptions(ris []bigtable.ReadItem, s interface{}, opts DecodeOptions) (err error) {
+
+	v, p, err := structPtrOf(s)
+	if err != nil || len(ris) == 0 {
+		return
+	}
 
-	if len(ris) == 0 || s == nil {
+	d := &decoder{key: ris[0].Row, opts: opts, used: map[string]bool{}}
+
+	if err = d.check("", nil, "", nil, readRowKeyParts(ris[0].Row, v, p)); err != nil {
 		return
 	}
 
-	fs := structs.New(s).Fields()
-	if len(fs) == 0 {
+	if f := p.rowKey; f != nil {
+		key := []bigtable.ReadItem{{Row: ris[0].Row, Value: []byte(ris[0].Row)}}
+		if err = d.decode(f, "", key, func() error {
+			return setValue(allocField(v, f.index), f.ti, []byte(ris[0].Row))
+		}); err != nil {
+			return
+		}
+	}
+
+	if err = readVersions(ris, v, p, d); err != nil {
 		return
 	}
 
+	all := ris
+	ris = latestItems(ris)
+
 	for i := range ris {
 
-		for _, f := range fs {
+		ri := ris[i : i+1]
 
-			t := f.Tag(BigtableTagName)
-			if t == "" {
-				continue
-			}
+		if err = p.readItemFields(ris[i].Column, func(f *fieldPlan) (err error) {
 
-			ti := GetBigtableTagInfo(t)
-			if ti.RowKey {
-				if err = setValue(f, []byte(ris[i].Row)); err != nil {
-					return
-				}
+			fv := allocField(v, f.index)
 
-				continue
+			if f.isPrefix {
+				return d.decode(f, ris[i].Column, ri, func() error {
+					return setMapValue(fv, f, ri)
+				})
 			}
 
-			cs := strings.Split(ris[i].Column, ColumnQualifierDelimiter)
-			if cs[len(cs)-1] == ti.Column {
-				if err = setValue(f, ris[i].Value); err != nil {
-					return
-				}
+			if err = d.decode(f, ris[i].Column, ri, func() error {
+				return setValue(fv, f.ti, ris[i].Value)
+			}); err != nil {
+				return
+			}
 
-				continue
+			if f.ts != nil {
+				err = setTimestamp(allocField(v, f.ts.index), ris[i].Timestamp)
 			}
+
+			return
+		}); err != nil {
+			return
 		}
 	}
+
+	if err = d.err(); err != nil {
+		return
+	}
+
+	err = d.readUnknown(all, v, p)
+
 	return
 }
 
-func setPointerValue(f *structs.Field, val []byte) (err error) {
-
-	aType := reflect.TypeOf(f.Value())
-	ptr := reflect.New(aType)
+// fieldFor returns the field of f in v to set the cells ris into.
+// The nil pointers to embedded structs on the way are allocated only if there are cells,
+// otherwise a zero value not in v is returned to validate the type of the field.
+func fieldFor(v reflect.Value, f *fieldPlan, ris []bigtable.ReadItem) reflect.Value {
 
-	switch reflect.ValueOf(f.Value()).Type().Elem().Kind() {
-	case reflect.String:
+	if fv, ok := lookupField(v, f.index); ok {
+		return fv
+	}
 
-		s := string(val)
+	if len(ris) == 0 {
+		return reflect.New(f.typ).Elem()
+	}
 
-		ptr.Elem().Set(reflect.ValueOf(&s))
-		f.Set(ptr.Elem().Interface())
+	return allocField(v, f.index)
+}
 
-	case reflect.Int:
+// matchColumn reports whether column in "family:qualifier" form is the one of a field tag.
+func matchColumn(column string, ti TagInfo) bool {
 
-		var n int64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	if ti.Family != "" {
+		return column == ti.Column
+	}
 
-		v := int(n)
-		ptr.Elem().Set(reflect.ValueOf(&v))
-		f.Set(ptr.Elem().Interface())
+	cs := strings.Split(column, ColumnQualifierDelimiter)
+	return cs[len(cs)-1] == ti.Column
+}
 
-	case reflect.Bool:
-		b := boolconv.BtoB(val).Tob()
+// splitColumn splits column in "family:qualifier" form.
+func splitColumn(column string) (family, qualifier string) {
 
-		ptr.Elem().Set(reflect.ValueOf(&b))
-		f.Set(ptr.Elem().Interface())
+	ss := strings.SplitN(column, ColumnQualifierDelimiter, 2)
+	if len(ss) < 2 {
+		return "", ss[0]
+	}
 
+	return ss[0], ss[1]
+}
 
-	case reflect.Uint:
-		var n uint64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+// setMapValue sets the values of ris into a map field keyed by their column qualifiers without prefix.
+func setMapValue(fv reflect.Value, f *fieldPlan, ris []bigtable.ReadItem) (err error) {
 
-		v := uint(n)
-		ptr.Elem().Set(reflect.ValueOf(&v))
-		f.Set(ptr.Elem().Interface())
+	mv := fv
+	if mv.Kind() != reflect.Map || mv.Type().Key().Kind() != reflect.String {
+		err = fmt.Errorf("cloth: %s should be a map with string keys, %s", f.ti.Column, f.name)
+		return
+	}
 
-	case reflect.Int8:
-		var n int8
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	if len(ris) == 0 {
+		return
+	}
 
-		v := int8(n)
-		ptr.Elem().Set(reflect.ValueOf(&v))
-		f.Set(ptr.Elem().Interface())
+	if mv.IsNil() {
+		mv = reflect.MakeMap(mv.Type())
+	}
 
-	case reflect.Uint8:
-		var n uint8
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	for _, ri := range ris {
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+		_, q := splitColumn(ri.Column)
+		q = strings.TrimPrefix(q, f.prefix)
 
-	case reflect.Int16:
-		var n int16
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+		v := reflect.New(mv.Type().Elem()).Elem()
+		if err = decodeValue(v, f.ti, ri.Value); err != nil {
+			return
+		}
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+		mv.SetMapIndex(reflect.ValueOf(q).Convert(mv.Type().Key()), v)
+	}
 
-	case reflect.Uint16:
-		var n uint16
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	fv.Set(mv)
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	return
+}
 
-	case reflect.Int32:
-		var n int32
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+func setPointerValue(v reflect.Value, ti TagInfo, val []byte) (err error) {
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	ptr := reflect.New(v.Type().Elem())
 
-	case reflect.Uint32:
-		var n uint32
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	switch ptr.Elem().Kind() {
+	case reflect.Ptr, reflect.Slice:
+		if ti.Encoding == "" && !isValueType(ptr.Elem().Type()) {
+			err = fmt.Errorf("cloth: unsupported pointer type. %v", v.Type())
+			return
+		}
+	}
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	if err = decodeValue(ptr.Elem(), ti, val); err != nil {
+		return
+	}
 
-	case reflect.Int64:
-		var n int64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	v.Set(ptr)
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	return
+}
 
-	case reflect.Uint64:
-		var n uint64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+func setValue(fv reflect.Value, ti TagInfo, val []byte) (err error) {
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	v := reflect.New(fv.Type()).Elem()
+	if err = decodeValue(v, ti, val); err != nil {
+		return
+	}
 
-	case reflect.Float32:
-		var n float32
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+	fv.Set(v)
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	return
+}
 
-	case reflect.Float64:
-		var n float64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+// decodeValue decodes val into v, which should be settable.
+func decodeValue(v reflect.Value, ti TagInfo, val []byte) (err error) {
 
-		ptr.Elem().Set(reflect.ValueOf(&n))
-		f.Set(ptr.Elem().Interface())
+	if v.Kind() == reflect.Ptr {
+		return setPointerValue(v, ti, val)
+	}
 
-	default:
-		err = fmt.Errorf("cloth: unsupported pointer type. %v", f.Kind())
+	if ti.Encoding != "" {
+		return decodeWith(ti.Encoding, v, val)
 	}
-	return
-}
 
-func setValue(f *structs.Field, val []byte) (err error) {
+	if ok, err := unmarshal(v, val); ok {
+		return err
+	}
 
-	switch f.Kind() {
+	switch v.Type() {
+	case timeType:
+		var t time.Time
+		t, err = decodeTime(ti.TimeFormat, val)
+		v.Set(reflect.ValueOf(t))
+		return
+	}
 
-	case reflect.Ptr:
-		err = setPointerValue(f, val)
+	switch v.Kind() {
 
 	case reflect.Slice:
-		if reflect.ValueOf(f.Value()).Type().Elem().Kind() == reflect.Uint8 {
+		if v.Type().Elem().Kind() == reflect.Uint8 {
 			// []byte
-			f.Set(val)
+			v.SetBytes(val)
 		}
 
 	case reflect.String:
-		f.Set(string(val))
+		v.SetString(string(val))
 
 	case reflect.Bool:
-		f.Set(boolconv.BtoB(val).Tob())
+		v.SetBool(boolconv.BtoB(val).Tob())
 
-	case reflect.Int:
-		var n int64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(int(n))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		n := reflect.New(numberTypes[v.Kind()])
+		err = binary.Read(bytes.NewReader(val), binary.BigEndian, n.Interface())
+		v.Set(n.Elem().Convert(v.Type()))
 
-	case reflect.Uint:
-		var n uint64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(uint(n))
-
-	case reflect.Int8:
-		var n int8
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+	default:
+		err = fmt.Errorf("cloth: unsupported type. %v", v.Kind())
 
-	case reflect.Uint8:
-		var n uint8
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+	}
 
-	case reflect.Int16:
-		var n int16
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+	return
+}
 
-	case reflect.Uint16:
-		var n uint16
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+func decodeTime(format string, val []byte) (t time.Time, err error) {
 
-	case reflect.Int32:
-		var n int32
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+	switch format {
 
-	case reflect.Uint32:
-		var n uint32
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+	case TimeFormatRFC3339:
+		t, err = time.Parse(time.RFC3339Nano, string(val))
 
-	case reflect.Int64:
+	case TimeFormatUnixMilli:
 		var n int64
 		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
-
-	case reflect.Uint64:
-		var n uint64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
-
-	case reflect.Float32:
-		var n float32
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
-
-	case reflect.Float64:
-		var n float64
-		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
-		f.Set(n)
+		if t = time.UnixMilli(n); t.IsZero() {
+			t = time.Time{}
+		}
 
 	default:
-		err = fmt.Errorf("cloth: unsupported type. %v", f.Kind())
-
+		var n int64
+		err = binary.Read(bytes.NewReader(val), binary.BigEndian, &n)
+		if t = time.Unix(0, n); n == zeroUnixNano {
+			t = time.Time{}
+		}
 	}
 
 	return
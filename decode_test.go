@@ -3,7 +3,9 @@ package btawel_test
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/osamingo/boolconv"
 
@@ -29,16 +31,25 @@ func TestReadRowErrorCase(t *testing.T) {
 	t.Run("No error", func(t *testing.T) {
 
 		t.Run("ReadRow", func(t *testing.T) {
-			err := btawel.ReadRow(row, struct{}{})
+			err := btawel.ReadRow(row, &struct{}{})
 			require.NoError(t, err)
 		})
 
 		t.Run("ReadItem", func(t *testing.T) {
-			err := btawel.ReadItems(ris, struct{}{})
+			err := btawel.ReadItems(ris, &struct{}{})
 			require.NoError(t, err)
 		})
 	})
 
+	t.Run("Error if it isn't a pointer to struct", func(t *testing.T) {
+		var nilPtr *struct{}
+		for _, s := range []interface{}{struct{}{}, map[string]string{}, nilPtr, nil} {
+
+			require.Error(t, btawel.ReadRow(row, s))
+			require.Error(t, btawel.ReadItems(ris, s))
+		}
+	})
+
 	t.Run("Error if type is different", func(t *testing.T) {
 		s := struct {
 			T int `bigtable:"test"`
@@ -313,6 +324,28 @@ func TestReadRowNestedStruct(t *testing.T) {
 	require.Equal(t, int32(16), person.Age)
 }
 
+func TestReadItemsNestedStruct(t *testing.T) {
+
+	ris := []bigtable.ReadItem{
+		{Row: "john", Column: "info:name", Value: []byte("John")},
+		{Row: "john", Column: "address:address", Value: []byte("Rafless st.")},
+	}
+
+	var person Person
+	require.NoError(t, btawel.ReadItems(ris, &person))
+	require.Equal(t, Person{Name: "John", Address: Address{Address: "Rafless st."}}, person)
+
+	t.Run("Unqualified column of nested struct", func(t *testing.T) {
+		var s struct {
+			Profile Profile
+		}
+		require.NoError(t, btawel.ReadItems([]bigtable.ReadItem{
+			{Row: "john", Column: "fc:bio", Value: []byte("WRYYY!")},
+		}, &s))
+		require.Equal(t, "WRYYY!", s.Profile.Bio)
+	})
+}
+
 func TestReadButDataDoesntExists(t *testing.T) {
 	row := map[string][]bigtable.ReadItem{}
 
@@ -570,3 +603,201 @@ func TestReadPointer(t *testing.T) {
 		require.Equal(t, float64(num), *s.TFloat64)
 	})
 }
+
+func TestReadItemsMultipleFamilies(t *testing.T) {
+
+	ris := []bigtable.ReadItem{
+		bigtable.ReadItem{
+			Row:    "john",
+			Column: "info:name",
+			Value:  []byte("John"),
+		},
+		bigtable.ReadItem{
+			Row:    "john",
+			Column: "address:name",
+			Value:  []byte("Home"),
+		},
+	}
+
+	var person struct {
+		Name        string `bigtable:"info:name"`
+		AddressName string `bigtable:"address:name"`
+	}
+	err := btawel.ReadItems(ris, &person)
+
+	require.NoError(t, err)
+	require.Equal(t, "John", person.Name)
+	require.Equal(t, "Home", person.AddressName)
+}
+
+func TestReadTime(t *testing.T) {
+
+	tm := time.Date(2018, 10, 1, 0, 0, 0, 123456789, time.UTC)
+
+	nano := make([]byte, 8)
+	binary.BigEndian.PutUint64(nano, uint64(tm.UnixNano()))
+	milli := make([]byte, 8)
+	binary.BigEndian.PutUint64(milli, uint64(tm.UnixNano()/int64(time.Millisecond)))
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, uint64(90*time.Second))
+
+	row := bigtable.Row{
+		"fc": []bigtable.ReadItem{
+			bigtable.ReadItem{Row: "key", Column: "fc:ttime", Value: nano},
+			bigtable.ReadItem{Row: "key", Column: "fc:tmilli", Value: milli},
+			bigtable.ReadItem{Row: "key", Column: "fc:trfc3339", Value: []byte("2018-10-01T00:00:00.123456789Z")},
+			bigtable.ReadItem{Row: "key", Column: "fc:tduration", Value: duration},
+		},
+	}
+
+	var s struct {
+		TTime      time.Time      `bigtable:"fc:ttime"`
+		TMilli     time.Time      `bigtable:"fc:tmilli, unixmilli"`
+		TRFC3339   time.Time      `bigtable:"fc:trfc3339, rfc3339"`
+		TDuration  time.Duration  `bigtable:"fc:tduration"`
+		TPTime     *time.Time     `bigtable:"fc:ttime"`
+		TPDuration *time.Duration `bigtable:"fc:tduration"`
+	}
+
+	t.Run("ReadRow", func(t *testing.T) {
+		err := btawel.ReadRow(row, &s)
+
+		require.NoError(t, err)
+		require.True(t, tm.Equal(s.TTime))
+		require.True(t, tm.Truncate(time.Millisecond).Equal(s.TMilli))
+		require.True(t, tm.Equal(s.TRFC3339))
+		require.Equal(t, 90*time.Second, s.TDuration)
+		require.True(t, tm.Equal(*s.TPTime))
+		require.Equal(t, 90*time.Second, *s.TPDuration)
+	})
+
+	t.Run("ReadItems", func(t *testing.T) {
+		err := btawel.ReadItems(row["fc"], &s)
+
+		require.NoError(t, err)
+		require.True(t, tm.Equal(s.TTime))
+		require.True(t, tm.Equal(s.TRFC3339))
+	})
+
+	t.Run("Error if time is invalid", func(t *testing.T) {
+		var s struct {
+			T time.Time `bigtable:"fc:ttime, rfc3339"`
+		}
+		require.Error(t, btawel.ReadRow(row, &s))
+	})
+}
+
+func TestReadMap(t *testing.T) {
+
+	one := make([]byte, 8)
+	binary.BigEndian.PutUint64(one, 1)
+	two := make([]byte, 8)
+	binary.BigEndian.PutUint64(two, 2)
+
+	row := bigtable.Row{
+		"info": []bigtable.ReadItem{
+			bigtable.ReadItem{Row: "john", Column: "info:name", Value: []byte("John")},
+		},
+		"stats": []bigtable.ReadItem{
+			bigtable.ReadItem{Row: "john", Column: "stats:2018-10-01", Value: one},
+			bigtable.ReadItem{Row: "john", Column: "stats:2018-10-02", Value: two},
+		},
+	}
+
+	type Stats struct {
+		Name  string           `bigtable:"info:name"`
+		Views map[string]int64 `bigtable:"stats:*"`
+		Empty map[string]int64 `bigtable:"empty:*"`
+	}
+
+	expected := map[string]int64{"2018-10-01": 1, "2018-10-02": 2}
+
+	t.Run("ReadRow", func(t *testing.T) {
+		var s Stats
+		err := btawel.ReadRow(row, &s)
+
+		require.NoError(t, err)
+		require.Equal(t, "John", s.Name)
+		require.Equal(t, expected, s.Views)
+		require.Nil(t, s.Empty)
+	})
+
+	t.Run("ReadItems", func(t *testing.T) {
+		var s Stats
+		err := btawel.ReadItems(append(row["info"], row["stats"]...), &s)
+
+		require.NoError(t, err)
+		require.Equal(t, "John", s.Name)
+		require.Equal(t, expected, s.Views)
+		require.Nil(t, s.Empty)
+	})
+
+	t.Run("Every column without family", func(t *testing.T) {
+		var s struct {
+			All map[string][]byte `bigtable:"*"`
+		}
+		err := btawel.ReadRow(row, &s)
+
+		require.NoError(t, err)
+		require.Len(t, s.All, 3)
+		require.Equal(t, []byte("John"), s.All["name"])
+	})
+
+	t.Run("Error if value is different type", func(t *testing.T) {
+		var s struct {
+			Views map[string]int64 `bigtable:"info:*"`
+		}
+		require.Error(t, btawel.ReadRow(row, &s))
+	})
+
+	t.Run("Error if field isn't a map", func(t *testing.T) {
+		var s struct {
+			Views []int64 `bigtable:"stats:*"`
+		}
+		require.Error(t, btawel.ReadRow(row, &s))
+	})
+}
+
+func TestReadPrefixedMap(t *testing.T) {
+
+	usd := make([]byte, 8)
+	binary.BigEndian.PutUint64(usd, math.Float64bits(10))
+	idr := make([]byte, 8)
+	binary.BigEndian.PutUint64(idr, math.Float64bits(150000))
+
+	ris := []bigtable.ReadItem{
+		bigtable.ReadItem{Row: "hotel", Column: "info:name", Value: []byte("Hotel")},
+		bigtable.ReadItem{Row: "hotel", Column: "info:price_IDR", Value: idr},
+		bigtable.ReadItem{Row: "hotel", Column: "info:price_USD", Value: usd},
+		bigtable.ReadItem{Row: "hotel", Column: "info:tax_IDR", Value: []byte("11%")},
+		bigtable.ReadItem{Row: "hotel", Column: "other:price_JPY", Value: []byte("invalid")},
+	}
+
+	type Hotel struct {
+		Name   string             `bigtable:"info:name"`
+		Prices map[string]float64 `bigtable:"info:price_*"`
+		Taxes  map[string]string  `bigtable:"info:tax_*"`
+	}
+
+	expected := Hotel{
+		Name:   "Hotel",
+		Prices: map[string]float64{"USD": 10, "IDR": 150000},
+		Taxes:  map[string]string{"IDR": "11%"},
+	}
+
+	t.Run("ReadRow", func(t *testing.T) {
+		var h Hotel
+		err := btawel.ReadRow(bigtable.Row{"info": ris[:4], "other": ris[4:]}, &h)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, h)
+	})
+
+	t.Run("ReadItems", func(t *testing.T) {
+		var h Hotel
+		err := btawel.ReadItems(ris, &h)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, h)
+	})
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/fatih/structs"
 	"github.com/osamingo/boolconv"
 
 	"cloud.google.com/go/bigtable"
@@ -22,6 +24,55 @@ func GenerateColumnsMutation(family string, t time.Time, i interface{}) (m *bigt
 	return
 }
 
+// GenerateRowMutation generates Mutation from Struct with its row key.
+func GenerateRowMutation(family string, t time.Time, i interface{}) (key string, m *bigtable.Mutation, err error) {
+
+	if key, err = GetRowKey(i); err != nil {
+		return
+	}
+
+	m, err = GenerateColumnsMutation(family, t, i)
+
+	return
+}
+
+// GenerateBulkMutations generates row keys and Mutations from Slice of Struct for bigtable.Table.ApplyBulk.
+func GenerateBulkMutations(family string, t time.Time, slice interface{}) (keys []string, ms []*bigtable.Mutation, err error) {
+
+	s := reflect.ValueOf(slice)
+	if s.Kind() != reflect.Slice {
+		err = fmt.Errorf("cloth: slice should be type slice")
+		return
+	}
+
+	if s.Len() == 0 {
+		err = fmt.Errorf("cloth: slice should not be empty")
+		return
+	}
+
+	keys = make([]string, s.Len())
+	ms = make([]*bigtable.Mutation, s.Len())
+
+	for i := 0; i < s.Len(); i++ {
+		if keys[i], ms[i], err = GenerateRowMutation(family, t, s.Index(i).Interface()); err != nil {
+			err = fmt.Errorf("cloth: index %d: %v", i, err)
+			keys, ms = nil, nil
+			return
+		}
+	}
+
+	return
+}
+
+// GenerateSelectedColumnsMutation generates Mutation from only the selected fields of Struct, see SetSelectedColumns.
+func GenerateSelectedColumnsMutation(family string, t time.Time, i interface{}, names ...string) (m *bigtable.Mutation, err error) {
+
+	m = bigtable.NewMutation()
+	err = SetSelectedColumns(family, t, m, i, names...)
+
+	return
+}
+
 // GenerateColumnQualifiersMutation generates Mutation from Slice.
 func GenerateColumnQualifiersMutation(family string, t time.Time, slice interface{}) (m *bigtable.Mutation, err error) {
 
@@ -32,44 +83,267 @@ func GenerateColumnQualifiersMutation(family string, t time.Time, slice interfac
 }
 
 // SetColumns sets columns of Mutation by Struct.
+// A field tagged as "family:column" is set into its own family, family is used for the other fields.
 func SetColumns(family string, t time.Time, m *bigtable.Mutation, i interface{}) (err error) {
 
-	if family == "" {
-		err = fmt.Errorf("cloth: family should not be empty")
+	if i == nil {
+		err = fmt.Errorf("cloth: struct should not be nil")
+		return
+	}
+
+	v, p, err := structOf(i)
+	if err != nil {
 		return
 	}
 
+	if v.NumField() == 0 {
+		err = fmt.Errorf("cloth: fields are not found, %v", i)
+		return
+	}
+
+	err = setColumns(family, t, m, v, p, nil)
+
+	return
+}
+
+// SetSelectedColumns sets columns of Mutation by only the selected fields of Struct.
+// A field is selected by its field name, its path through nested structs such as "Address.Address",
+// or its column such as "family:column". Selecting a nested struct selects all of its fields.
+// A selected field is set even if it's a zero value tagged as omitempty.
+// An error is returned if a name doesn't select any field.
+func SetSelectedColumns(family string, t time.Time, m *bigtable.Mutation, i interface{}, names ...string) (err error) {
+
 	if i == nil {
 		err = fmt.Errorf("cloth: struct should not be nil")
 		return
 	}
 
-	fs := structs.New(i).Fields()
-	if len(fs) == 0 {
+	if len(names) == 0 {
+		err = fmt.Errorf("cloth: names should not be empty")
+		return
+	}
+
+	v, p, err := structOf(i)
+	if err != nil {
+		return
+	}
+
+	if v.NumField() == 0 {
 		err = fmt.Errorf("cloth: fields are not found, %v", i)
 		return
 	}
 
-	for _, f := range fs {
+	sel := fieldSelector{}
+	for _, n := range names {
+		sel[n] = false
+	}
+
+	if err = setColumns(family, t, m, v, p, sel); err != nil {
+		return
+	}
+
+	for _, n := range names {
+		if !sel[n] {
+			err = fmt.Errorf("cloth: field or column %q is not found", n)
+			return
+		}
+	}
+
+	return
+}
+
+// fieldSelector is the set of names selecting fields, and whether each of them selected a field.
+// nil selects all fields.
+type fieldSelector map[string]bool
+
+// selects reports whether any of names is selected, and marks them as used.
+func (s fieldSelector) selects(names ...string) (ok bool) {
+
+	for _, n := range names {
+		if _, found := s[n]; found {
+			s[n] = true
+			ok = true
+		}
+	}
+
+	return
+}
+
+// selectsParent reports whether a nested struct of the field at path is selected, and marks them as used.
+func (s fieldSelector) selectsParent(path string) (ok bool) {
+
+	for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+		if s.selects(path[:i]) {
+			ok = true
+		}
+	}
+
+	return
+}
+
+// set columns for the selected fields of struct, nested structs included
+func setColumns(family string, t time.Time, m *bigtable.Mutation, v reflect.Value, p *structPlan, sel fieldSelector) (err error) {
+
+	for _, f := range p.fields {
+
+		ti := f.ti
+
+		// all fields of a selected nested struct are selected
+		whole := sel == nil || sel.selectsParent(f.name)
+
+		if ti.Unknown {
+			selected := sel.selects(f.name)
+			if fv, ok := lookupField(v, f.index); ok && (selected || whole) {
+				if err = setUnknownColumns(family, t, m, fv, f); err != nil {
+					return
+				}
+			}
+			continue
+		}
+
+		if ti.Ignore || ti.Column == "" {
+			continue
+		}
+
+		fm := ti.Family
+		if fm == "" {
+			fm = family
+		}
+
+		selected := sel.selects(f.name, ti.Column, fm+ColumnQualifierDelimiter+ti.ColumnQualifier)
+		if !selected && !whole {
+			continue
+		}
+
+		fv, ok := lookupField(v, f.index)
+		if !ok {
+			// a field of a nil embedded struct is omitted unless it's selected
+			if !selected {
+				continue
+			}
+			if !ti.Nullable {
+				err = fmt.Errorf("cloth: selected field %s can't be set, its embedded struct is nil", f.name)
+				return
+			}
+			fv = reflect.Zero(f.typ)
+		}
+
+		if !selected && ti.Omitempty && !ti.Nullable && isZero(fv) {
+			continue
+		}
 
-		tg := f.Tag(BigtableTagName)
-		if tg == "" {
+		if fm == "" {
+			err = fmt.Errorf("cloth: family should not be empty, %s", f.name)
+			return
+		}
+
+		if ti.Nullable && isZero(fv) {
+			if f.isPrefix {
+				err = fmt.Errorf("cloth: nullable is not supported for %s, %s", ti.Column, f.name)
+				return
+			}
+			m.DeleteCellsInColumn(fm, ti.ColumnQualifier)
+			continue
+		}
+
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			// a nil pointer is omitted unless it's selected
+			if selected {
+				err = fmt.Errorf("cloth: selected field %s can't be set, it's nil and not nullable", f.name)
+				return
+			}
+			continue
+		}
+
+		if ti.Versions {
+			if err = setVersionColumns(fm, ti.ColumnQualifier, t, m, fv, ti); err != nil {
+				return
+			}
 			continue
 		}
 
-		ti := GetBigtableTagInfo(tg)
-		if ti.Ignore || ti.Column == "" || ti.Omitempty && f.IsZero() {
+		if f.isPrefix {
+			if err = setMapColumns(fm, t, m, fv, f); err != nil {
+				return
+			}
 			continue
 		}
 
 		var b []byte
-		b, err = getBytes(f)
+		b, err = getBytes(fv, ti)
 		if err != nil {
-			m = nil
-			break
+			return
+		}
+
+		ts := bigtable.Time(t)
+		if f.ts != nil {
+			if tv, ok := lookupField(v, f.ts.index); ok {
+				if ts, err = getTimestamp(tv, ts); err != nil {
+					return
+				}
+			}
+		}
+
+		m.Set(fm, ti.ColumnQualifier, ts, b)
+	}
+
+	return
+}
+
+// setMapColumns sets a column for each entry of a map field, its key prefixed by prefix is the column qualifier.
+func setMapColumns(family string, t time.Time, m *bigtable.Mutation, mv reflect.Value, f *fieldPlan) (err error) {
+
+	if mv.Kind() != reflect.Map || mv.Type().Key().Kind() != reflect.String {
+		err = fmt.Errorf("cloth: %s should be a map with string keys, %s", f.ti.Column, f.name)
+		return
+	}
+
+	ks := mv.MapKeys()
+	sort.Slice(ks, func(i, j int) bool {
+		return ks[i].String() < ks[j].String()
+	})
+
+	for _, k := range ks {
+
+		var b []byte
+		if b, err = getBytes(mv.MapIndex(k), f.ti); err != nil {
+			return
 		}
 
-		m.Set(family, ti.Column, bigtable.Time(t), b)
+		m.Set(family, f.prefix+k.String(), bigtable.Time(t), b)
+	}
+
+	return
+}
+
+// setUnknownColumns sets a column for each entry of the field tagged as unknown keyed by "family:qualifier",
+// family is used for the keys without a family.
+func setUnknownColumns(family string, t time.Time, m *bigtable.Mutation, fv reflect.Value, f *fieldPlan) (err error) {
+
+	vals, ok := fv.Interface().(map[string][]byte)
+	if !ok {
+		err = fmt.Errorf("cloth: unknown field should be map[string][]byte, %s", f.name)
+		return
+	}
+
+	ks := make([]string, 0, len(vals))
+	for k := range vals {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+
+		fm, q := splitColumn(k)
+		if fm == "" {
+			fm = family
+		}
+		if fm == "" {
+			err = fmt.Errorf("cloth: family should not be empty, %s", k)
+			return
+		}
+
+		m.Set(fm, q, bigtable.Time(t), vals[k])
 	}
 
 	return
@@ -96,75 +370,122 @@ func SetColumnQualifiers(family string, t time.Time, m *bigtable.Mutation, slice
 
 	for i := 0; i < s.Len(); i++ {
 
-		fs := structs.New(s.Index(i).Interface()).Fields()
-		if len(fs) == 0 {
-			err = fmt.Errorf("cloth: fields are not found, %v", i)
-			return
+		v, p, err := structOf(s.Index(i).Interface())
+		if err != nil {
+			return fmt.Errorf("cloth: index %d: %v", i, err)
 		}
 
-		for _, f := range fs {
-
-			tg := f.Tag(BigtableTagName)
-			if tg == "" {
-				continue
-			}
+		if v.NumField() == 0 {
+			err = fmt.Errorf("cloth: fields are not found, %v", i)
+			return err
+		}
 
-			ti := GetBigtableTagInfo(tg)
-			if ti.Qualifier && !f.IsZero() {
-				m.Set(family, fmt.Sprintf("%s", f.Value()), bigtable.Time(t), nil)
+		for _, f := range p.columnQualifiers {
+			if fv, ok := lookupField(v, f.index); ok && !isZero(fv) {
+				m.Set(family, fmt.Sprintf("%s", fv.Interface()), bigtable.Time(t), nil)
 			}
-
 		}
 	}
 
 	return
 }
 
-func getBytes(f *structs.Field) ([]byte, error) {
+func getBytes(v reflect.Value, ti TagInfo) ([]byte, error) {
 
-	var b *bytes.Buffer
+	if v.Kind() == reflect.Ptr {
+		return getPointerBytes(v, ti)
+	}
 
-	switch f.Kind() {
+	if ti.Encoding != "" {
+		return encodeWith(ti.Encoding, v)
+	}
+
+	if b, ok, err := marshal(v); ok {
+		return b, err
+	}
+
+	switch v.Type() {
+	case timeType:
+		return encodeTime(ti.TimeFormat, v.Interface().(time.Time))
+	}
+
+	switch v.Kind() {
 
 	case reflect.Slice:
-		if reflect.ValueOf(f.Value()).Type().Elem().Kind() == reflect.Uint8 {
+		if v.Type().Elem().Kind() == reflect.Uint8 {
 			// []byte
-			return (f.Value()).([]byte), nil
+			return v.Bytes(), nil
 		}
 
 	case reflect.String:
-		return []byte((f.Value()).(string)), nil
+		return []byte(v.String()), nil
 
 	case reflect.Bool:
-		return boolconv.NewBool((f.Value()).(bool)).Bytes(), nil
+		return boolconv.NewBool(v.Bool()).Bytes(), nil
 
-	case reflect.Int8, reflect.Uint8:
-		b = bytes.NewBuffer(make([]byte, 0, 2))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		b := bytes.NewBuffer(make([]byte, 0, numberTypes[v.Kind()].Size()))
+		err := binary.Write(b, binary.BigEndian, v.Convert(numberTypes[v.Kind()]).Interface())
+		return b.Bytes(), err
 
-	case reflect.Int16, reflect.Uint16:
-		b = bytes.NewBuffer(make([]byte, 0, binary.MaxVarintLen16))
+	}
 
-	case reflect.Int32, reflect.Uint32:
-		b = bytes.NewBuffer(make([]byte, 0, binary.MaxVarintLen32))
+	return nil, fmt.Errorf("cloth: unsupported type. %v", v.Kind())
+}
 
-	case reflect.Int64, reflect.Uint64, reflect.Int, reflect.Uint, reflect.Float32, reflect.Float64:
-		b = bytes.NewBuffer(make([]byte, 0, binary.MaxVarintLen64))
+// getPointerBytes gets bytes of the value v points to, the types setPointerValue supports.
+func getPointerBytes(v reflect.Value, ti TagInfo) ([]byte, error) {
 
+	if v.IsNil() {
+		return nil, fmt.Errorf("cloth: pointer should not be nil. %v", v.Type())
 	}
 
-	if b != nil {
-
-		i := f.Value()
-		if f.Kind() == reflect.Int {
-			i = int64(i.(int))
-		}
-		if f.Kind() == reflect.Uint {
-			i = uint64(i.(uint))
+	switch v.Elem().Kind() {
+	case reflect.Ptr, reflect.Slice:
+		if ti.Encoding == "" && !isValueType(v.Elem().Type()) {
+			return nil, fmt.Errorf("cloth: unsupported pointer type. %v", v.Type())
 		}
+	}
 
-		err := binary.Write(b, binary.BigEndian, i)
-		return b.Bytes(), err
+	return getBytes(v.Elem(), ti)
+}
+
+// zeroUnixNano is the Unix time in nanoseconds the zero time.Time is stored as,
+// which is out of range of the other times.
+const zeroUnixNano = math.MinInt64
+
+var (
+	minUnixNano = time.Unix(0, zeroUnixNano+1)
+	maxUnixNano = time.Unix(0, math.MaxInt64)
+)
+
+func encodeTime(format string, t time.Time) ([]byte, error) {
+
+	var n int64
+
+	switch format {
+
+	case TimeFormatRFC3339:
+		return []byte(t.Format(time.RFC3339Nano)), nil
+
+	case TimeFormatUnixMilli:
+		n = t.UnixMilli()
+
+	default:
+		switch {
+		case t.IsZero():
+			n = zeroUnixNano
+		case t.Before(minUnixNano) || t.After(maxUnixNano):
+			return nil, fmt.Errorf("cloth: %v is out of range of %s", t, TimeFormatUnixNano)
+		default:
+			n = t.UnixNano()
+		}
 	}
 
-	return nil, fmt.Errorf("cloth: unsupported type. %v", f.Kind())
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+
+	return b, nil
 }
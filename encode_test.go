@@ -3,11 +3,16 @@ package btawel_test
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 	"reflect"
 	"testing"
 	"time"
 
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
 	"github.com/osamingo/boolconv"
+	"github.com/stretchr/testify/require"
 	"github.com/tvlk-data/btawel"
 )
 
@@ -243,3 +248,597 @@ func TestGenerateColumnsMutation(t *testing.T) {
 	}
 
 }
+
+// testFamilies are the column families of the table mutations are applied to in tests.
+var testFamilies = []string{"fc", "info", "address", "stats", "likes"}
+
+// applyMutations applies Mutations in order to a row of a table of the emulator and reads the row.
+func applyMutations(t testing.TB, key string, ms ...*bigtable.Mutation) bigtable.Row {
+
+	tbl, closer := newTestTable(t, testFamilies...)
+	defer closer()
+
+	ctx := context.Background()
+	for _, m := range ms {
+		require.NoError(t, tbl.Apply(ctx, key, m))
+	}
+
+	row, err := tbl.ReadRow(ctx, key)
+	require.NoError(t, err)
+
+	return row
+}
+
+// setCells returns the newest values of the cells set by a Mutation keyed by "family:qualifier".
+func setCells(t testing.TB, m *bigtable.Mutation) map[string][]byte {
+
+	cs := map[string][]byte{}
+	for _, ris := range applyMutations(t, "row", m) {
+		for _, ri := range ris {
+			if _, ok := cs[ri.Column]; !ok {
+				cs[ri.Column] = ri.Value
+			}
+		}
+	}
+
+	return cs
+}
+
+type Profile struct {
+	Bio     string `bigtable:"bio"`
+	Country string `bigtable:"address:country"`
+}
+
+func TestGenerateColumnsMutationNestedStruct(t *testing.T) {
+
+	s := struct {
+		Name    string `bigtable:"name"`
+		Profile Profile
+		Person  Person
+	}{
+		Name: "John",
+		Profile: Profile{
+			Bio:     "WRYYY!",
+			Country: "Indonesia",
+		},
+		Person: Person{
+			Name:    "Jane",
+			Age:     16,
+			Address: Address{Address: "Rafless st."},
+		},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &s)
+	require.NoError(t, err)
+
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(16))
+
+	require.Equal(t, map[string][]byte{
+		"fc:name":         []byte("John"),
+		"fc:bio":          []byte("WRYYY!"),
+		"address:country": []byte("Indonesia"),
+		"info:name":       []byte("Jane"),
+		"info:age":        buf,
+		"address:address": []byte("Rafless st."),
+	}, setCells(t, m))
+
+	t.Run("Ignored nested struct isn't written", func(t *testing.T) {
+		s := struct {
+			Name    string  `bigtable:"info:name"`
+			Address Address `bigtable:"-"`
+		}{
+			Name:    "John",
+			Address: Address{Address: "Rafless st."},
+		}
+
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"info:name": []byte("John")}, setCells(t, m))
+	})
+}
+
+func TestGenerateColumnsMutationMultipleFamilies(t *testing.T) {
+
+	s := struct {
+		Name  string `bigtable:"info:name"`
+		Email string `bigtable:"info:email"`
+		Count int64  `bigtable:"stats:count"`
+		Note  string `bigtable:"note"`
+	}{
+		Name:  "John",
+		Email: "john@example.com",
+		Count: 1,
+		Note:  "WRYYY!",
+	}
+
+	m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &s)
+	require.NoError(t, err)
+
+	cs := setCells(t, m)
+	require.Len(t, cs, 4)
+	require.Equal(t, []byte("John"), cs["info:name"])
+	require.Equal(t, []byte("john@example.com"), cs["info:email"])
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1}, cs["stats:count"])
+	require.Equal(t, []byte("WRYYY!"), cs["fc:note"])
+
+	t.Run("family can be empty if all tags have a family", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &struct {
+			Name string `bigtable:"info:name"`
+		}{"John"})
+		require.NoError(t, err)
+	})
+
+	t.Run("family is empty", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+		require.Error(t, err)
+	})
+}
+
+func TestGenerateSelectedColumnsMutation(t *testing.T) {
+
+	s := struct {
+		Name    string `bigtable:"name"`
+		Email   string `bigtable:"info:email"`
+		Note    string `bigtable:"note, omitempty"`
+		Profile Profile
+		Person  Person
+	}{
+		Name:    "John",
+		Email:   "john@example.com",
+		Profile: Profile{Bio: "WRYYY!", Country: "Indonesia"},
+		Person:  Person{Name: "Jane", Address: Address{Address: "Rafless st."}},
+	}
+
+	t.Run("By field name", func(t *testing.T) {
+		m, err := btawel.GenerateSelectedColumnsMutation("fc", time.Now(), &s, "Name", "Profile.Bio")
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{
+			"fc:name": []byte("John"),
+			"fc:bio":  []byte("WRYYY!"),
+		}, setCells(t, m))
+	})
+
+	t.Run("By column", func(t *testing.T) {
+		m, err := btawel.GenerateSelectedColumnsMutation("fc", time.Now(), &s, "info:email", "fc:name", "address:country")
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{
+			"info:email":      []byte("john@example.com"),
+			"fc:name":         []byte("John"),
+			"address:country": []byte("Indonesia"),
+		}, setCells(t, m))
+	})
+
+	t.Run("Nested struct selects all of its fields", func(t *testing.T) {
+		m, err := btawel.GenerateSelectedColumnsMutation("fc", time.Now(), &s, "Person.Address")
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{
+			"address:address": []byte("Rafless st."),
+		}, setCells(t, m))
+	})
+
+	t.Run("Zero value with omitempty is set", func(t *testing.T) {
+		m, err := btawel.GenerateSelectedColumnsMutation("fc", time.Now(), &s, "Note")
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"fc:note": nil}, setCells(t, m), "the empty cell is written")
+	})
+
+	t.Run("Error if name is unknown", func(t *testing.T) {
+		_, err := btawel.GenerateSelectedColumnsMutation("fc", time.Now(), &s, "Name", "Unknown")
+		require.Error(t, err)
+	})
+
+	t.Run("Nil selected field", func(t *testing.T) {
+		type Nils struct {
+			S *string `bigtable:"fc:s"`
+			N *string `bigtable:"fc:n, nullable"`
+		}
+
+		_, err := btawel.GenerateSelectedColumnsMutation("", time.Now(), &Nils{}, "S")
+		require.EqualError(t, err, "cloth: selected field S can't be set, it's nil and not nullable")
+
+		str := "hoge"
+		old, err := btawel.GenerateColumnsMutation("", time.Now(), &Nils{N: &str})
+		require.NoError(t, err)
+
+		m, err := btawel.GenerateSelectedColumnsMutation("", time.Now(), &Nils{}, "N")
+		require.NoError(t, err)
+		require.Empty(t, applyMutations(t, "row", old, m), "nullable column is deleted")
+	})
+
+	t.Run("Selected field of nil embedded struct", func(t *testing.T) {
+		_, err := btawel.GenerateSelectedColumnsMutation("", time.Now(), &Comment{ID: "x"}, "Version")
+		require.EqualError(t, err, "cloth: selected field Version can't be set, its embedded struct is nil")
+
+		_, err = btawel.GenerateSelectedColumnsMutation("", time.Now(), &Comment{ID: "x"}, "Body")
+		require.NoError(t, err, "unselected fields of nil embedded struct are omitted")
+	})
+
+	t.Run("Error if names are empty", func(t *testing.T) {
+		_, err := btawel.GenerateSelectedColumnsMutation("fc", time.Now(), &s)
+		require.Error(t, err)
+	})
+}
+
+func TestGenerateColumnsMutationNullable(t *testing.T) {
+
+	type Post struct {
+		Title   string  `bigtable:"fc:title, nullable"`
+		Content *string `bigtable:"fc:content, nullable"`
+		Views   int64   `bigtable:"stats:views, nullable, omitempty"`
+	}
+
+	content := "WRYYY!"
+	old, err := btawel.GenerateColumnsMutation("", time.Now(), &Post{Title: "Hi", Content: &content, Views: 2})
+	require.NoError(t, err)
+
+	t.Run("Zero values delete columns", func(t *testing.T) {
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &Post{})
+		require.NoError(t, err)
+
+		require.Empty(t, applyMutations(t, "post", old, m))
+	})
+
+	t.Run("Non-zero values are set", func(t *testing.T) {
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &Post{Title: "Hello", Views: 1})
+		require.NoError(t, err)
+
+		var got Post
+		require.NoError(t, btawel.ReadRow(applyMutations(t, "post", old, m), &got))
+		require.Equal(t, Post{Title: "Hello", Views: 1}, got)
+	})
+
+	t.Run("Error if map is prefixed", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &struct {
+			Attrs map[string]string `bigtable:"fc:attr_*, nullable"`
+		}{})
+		require.Error(t, err)
+	})
+}
+
+func TestGenerateColumnsMutationPointer(t *testing.T) {
+
+	type Pointers struct {
+		TRowKey  *string  `bigtable:",rowkey"`
+		TString  *string  `bigtable:"fc:tstr"`
+		TBool    *bool    `bigtable:"fc:tbool"`
+		TInt     *int     `bigtable:"fc:tint"`
+		TInt8    *int8    `bigtable:"fc:tint8"`
+		TInt16   *int16   `bigtable:"fc:tint16"`
+		TInt32   *int32   `bigtable:"fc:tint32"`
+		TInt64   *int64   `bigtable:"fc:tint64"`
+		TUint    *uint    `bigtable:"fc:tuint"`
+		TUint8   *uint8   `bigtable:"fc:tuint8"`
+		TUint16  *uint16  `bigtable:"fc:tuint16"`
+		TUint32  *uint32  `bigtable:"fc:tuint32"`
+		TUint64  *uint64  `bigtable:"fc:tuint64"`
+		TFloat32 *float32 `bigtable:"fc:tfloat32"`
+		TFloat64 *float64 `bigtable:"fc:tfloat64"`
+		TNil     *string  `bigtable:"fc:tnil"`
+	}
+
+	key := "thisisrowkey"
+	str := "hoge"
+	bl := true
+	i, i8, i16, i32, i64 := int(123), int8(123), int16(123), int32(123), int64(123)
+	u, u8, u16, u32, u64 := uint(123), uint8(123), uint16(123), uint32(123), uint64(123)
+	f32, f64 := float32(123), float64(123)
+
+	s := Pointers{
+		TRowKey:  &key,
+		TString:  &str,
+		TBool:    &bl,
+		TInt:     &i,
+		TInt8:    &i8,
+		TInt16:   &i16,
+		TInt32:   &i32,
+		TInt64:   &i64,
+		TUint:    &u,
+		TUint8:   &u8,
+		TUint16:  &u16,
+		TUint32:  &u32,
+		TUint64:  &u64,
+		TFloat32: &f32,
+		TFloat64: &f64,
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+	require.NoError(t, err)
+
+	number := func(n interface{}) []byte {
+		buf := &bytes.Buffer{}
+		binary.Write(buf, binary.BigEndian, n)
+		return buf.Bytes()
+	}
+
+	require.Equal(t, map[string][]byte{
+		"fc:tstr":     []byte(str),
+		"fc:tbool":    boolconv.NewBool(bl).Bytes(),
+		"fc:tint":     number(int64(i)),
+		"fc:tint8":    number(i8),
+		"fc:tint16":   number(i16),
+		"fc:tint32":   number(i32),
+		"fc:tint64":   number(i64),
+		"fc:tuint":    number(uint64(u)),
+		"fc:tuint8":   number(u8),
+		"fc:tuint16":  number(u16),
+		"fc:tuint32":  number(u32),
+		"fc:tuint64":  number(u64),
+		"fc:tfloat32": number(f32),
+		"fc:tfloat64": number(f64),
+	}, setCells(t, m), "nil pointer is omitted")
+
+	t.Run("Round trip", func(t *testing.T) {
+		k, m, err := btawel.GenerateRowMutation("", time.Now(), &s)
+		require.NoError(t, err)
+		require.Equal(t, key, k)
+
+		var got Pointers
+		require.NoError(t, btawel.ReadRow(applyMutations(t, k, m), &got))
+		require.Equal(t, s, got)
+	})
+
+	t.Run("Error if rowkey is nil", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&Pointers{TString: &str})
+		require.Error(t, err)
+	})
+
+	t.Run("Time and marshaler", func(t *testing.T) {
+		now := time.Unix(1538352000, 0)
+		money := Money{Amount: 100, Currency: "IDR"}
+
+		m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			CreatedAt *time.Time `bigtable:"createdAt, unixmilli"`
+			Balance   *Money     `bigtable:"balance"`
+		}{&now, &money})
+		require.NoError(t, err)
+
+		b, _ := money.MarshalBigtable()
+		require.Equal(t, number(now.UnixNano()/int64(time.Millisecond)), setCells(t, m)["fc:createdAt"])
+		require.Equal(t, b, setCells(t, m)["fc:balance"])
+	})
+
+	t.Run("Error if pointer to pointer", func(t *testing.T) {
+		p := &str
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			S **string `bigtable:"s"`
+		}{&p})
+		require.Error(t, err)
+	})
+}
+
+func TestGenerateRowMutation(t *testing.T) {
+
+	t.Run("Rowkey and mutation are generated", func(t *testing.T) {
+		key, m, err := btawel.GenerateRowMutation("fc", time.Now(), &User{
+			ID:   "john",
+			Name: "John",
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, "john", key)
+		require.Equal(t, []byte("John"), setCells(t, m)["fc:name"])
+	})
+
+	t.Run("Rowkey can be bytes", func(t *testing.T) {
+		key, err := btawel.GetRowKey(&struct {
+			ID []byte `bigtable:",rowkey"`
+		}{[]byte("john")})
+
+		require.NoError(t, err)
+		require.Equal(t, "john", key)
+	})
+
+	t.Run("Error if rowkey is empty", func(t *testing.T) {
+		_, _, err := btawel.GenerateRowMutation("fc", time.Now(), &User{Name: "John"})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if rowkey is not found", func(t *testing.T) {
+		_, _, err := btawel.GenerateRowMutation("fc", time.Now(), &Person{Name: "John"})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if rowkey is unsupported type", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&struct {
+			ID bool `bigtable:",rowkey"`
+		}{true})
+		require.Error(t, err)
+	})
+}
+
+func TestGenerateBulkMutations(t *testing.T) {
+
+	// slice is nil
+	if _, _, err := btawel.GenerateBulkMutations("fc", time.Now(), nil); err == nil {
+		t.Error("error isn't occurred")
+	}
+
+	// slice is empty
+	if _, _, err := btawel.GenerateBulkMutations("fc", time.Now(), []User{}); err == nil {
+		t.Error("error isn't occurred")
+	}
+
+	t.Run("Keys and mutations are generated", func(t *testing.T) {
+		keys, ms, err := btawel.GenerateBulkMutations("fc", time.Now(), []*User{
+			&User{ID: "john", Name: "John"},
+			&User{ID: "jane", Name: "Jane"},
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"john", "jane"}, keys)
+		require.Len(t, ms, 2)
+		require.Equal(t, []byte("John"), setCells(t, ms[0])["fc:name"])
+		require.Equal(t, []byte("Jane"), setCells(t, ms[1])["fc:name"])
+	})
+
+	t.Run("Elements can be struct", func(t *testing.T) {
+		keys, ms, err := btawel.GenerateBulkMutations("fc", time.Now(), []User{
+			User{ID: "john", Name: "John"},
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"john"}, keys)
+		require.Len(t, ms, 1)
+	})
+
+	t.Run("Error reports the failed index", func(t *testing.T) {
+		_, _, err := btawel.GenerateBulkMutations("fc", time.Now(), []*User{
+			&User{ID: "john", Name: "John"},
+			&User{Name: "Jane"},
+		})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "index 1")
+	})
+}
+
+func TestGenerateColumnsMutationTime(t *testing.T) {
+
+	tm := time.Date(2018, 10, 1, 0, 0, 0, 123456789, time.UTC)
+
+	s := struct {
+		TTime     time.Time     `bigtable:"ttime"`
+		TNano     time.Time     `bigtable:"tnano, unixnano"`
+		TMilli    time.Time     `bigtable:"tmilli, unixmilli"`
+		TRFC3339  time.Time     `bigtable:"trfc3339, rfc3339"`
+		TDuration time.Duration `bigtable:"tduration"`
+		TOmitTime time.Time     `bigtable:"tomittime, omitempty"`
+	}{
+		TTime:     tm,
+		TNano:     tm,
+		TMilli:    tm,
+		TRFC3339:  tm,
+		TDuration: 90 * time.Second,
+	}
+
+	m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &s)
+	require.NoError(t, err)
+
+	nano := make([]byte, 8)
+	binary.BigEndian.PutUint64(nano, uint64(tm.UnixNano()))
+	milli := make([]byte, 8)
+	binary.BigEndian.PutUint64(milli, uint64(tm.UnixNano()/int64(time.Millisecond)))
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, uint64(90*time.Second))
+
+	require.Equal(t, map[string][]byte{
+		"fc:ttime":     nano,
+		"fc:tnano":     nano,
+		"fc:tmilli":    milli,
+		"fc:trfc3339":  []byte("2018-10-01T00:00:00.123456789Z"),
+		"fc:tduration": duration,
+	}, setCells(t, m))
+
+	t.Run("Zero time is read back", func(t *testing.T) {
+		var zero struct {
+			TNano    time.Time `bigtable:"fc:tnano"`
+			TMilli   time.Time `bigtable:"fc:tmilli, unixmilli"`
+			TRFC3339 time.Time `bigtable:"fc:trfc3339, rfc3339"`
+		}
+
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &zero)
+		require.NoError(t, err)
+
+		row := applyMutations(t, "row", m)
+		require.Len(t, row["fc"], 3)
+
+		zero.TNano = tm
+		zero.TMilli = tm
+		zero.TRFC3339 = tm
+		require.NoError(t, btawel.ReadRow(row, &zero))
+		require.Equal(t, time.Time{}, zero.TNano)
+		require.Equal(t, time.Time{}, zero.TMilli)
+		require.Equal(t, time.Time{}, zero.TRFC3339)
+	})
+
+	t.Run("Milliseconds out of range of nanoseconds", func(t *testing.T) {
+		far := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			T time.Time `bigtable:"t"`
+		}{far})
+		require.Error(t, err)
+
+		m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			T time.Time `bigtable:"t, unixmilli"`
+		}{far})
+		require.NoError(t, err)
+
+		var got struct {
+			T time.Time `bigtable:"fc:t, unixmilli"`
+		}
+		require.NoError(t, btawel.ReadRow(applyMutations(t, "row", m), &got))
+		require.True(t, far.Equal(got.T))
+	})
+}
+
+func TestGenerateColumnsMutationMap(t *testing.T) {
+
+	s := struct {
+		Name   string            `bigtable:"info:name"`
+		Views  map[string]int64  `bigtable:"stats:*"`
+		Labels map[string]string `bigtable:"*"`
+		Likes  map[string]int    `bigtable:"likes:*, enc=string"`
+	}{
+		Name:   "John",
+		Views:  map[string]int64{"2018-10-01": 1, "2018-10-02": 2},
+		Labels: map[string]string{"env": "prod"},
+		Likes:  map[string]int{"2018-10-01": 3},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &s)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string][]byte{
+		"info:name":        []byte("John"),
+		"stats:2018-10-01": []byte{0, 0, 0, 0, 0, 0, 0, 1},
+		"stats:2018-10-02": []byte{0, 0, 0, 0, 0, 0, 0, 2},
+		"fc:env":           []byte("prod"),
+		"likes:2018-10-01": []byte("3"),
+	}, setCells(t, m))
+
+	t.Run("Error if field isn't a map", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			Views []int64 `bigtable:"stats:*"`
+		}{})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if value is unsupported type", func(t *testing.T) {
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), &struct {
+			Views map[string][]int64 `bigtable:"stats:*"`
+		}{map[string][]int64{"a": nil}})
+		require.Error(t, err)
+	})
+}
+
+func TestGenerateColumnsMutationPrefixedMap(t *testing.T) {
+
+	s := struct {
+		Name   string             `bigtable:"info:name"`
+		Prices map[string]float64 `bigtable:"info:price_*"`
+	}{
+		Name:   "Hotel",
+		Prices: map[string]float64{"USD": 10, "IDR": 150000},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+	require.NoError(t, err)
+
+	usd := make([]byte, 8)
+	binary.BigEndian.PutUint64(usd, math.Float64bits(10))
+	idr := make([]byte, 8)
+	binary.BigEndian.PutUint64(idr, math.Float64bits(150000))
+
+	require.Equal(t, map[string][]byte{
+		"info:name":      []byte("Hotel"),
+		"info:price_USD": usd,
+		"info:price_IDR": idr,
+	}, setCells(t, m))
+}
@@ -0,0 +1,130 @@
+package btawel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// columnPatterns are the column qualifier patterns of a family.
+type columnPatterns struct {
+	family   string
+	patterns []string
+	all      bool
+}
+
+// FilterFor generates a Filter reading only the columns tagged in a struct, nested structs included.
+// Only the newest version of each column is read unless a field is tagged as versions.
+// The columns tagged without a family are read from any family,
+// and every column is read if a field is tagged as unknown.
+func FilterFor(i interface{}) (f bigtable.Filter, err error) {
+
+	if i == nil {
+		err = fmt.Errorf("cloth: struct should not be nil")
+		return
+	}
+
+	_, p, err := structOf(i)
+	if err != nil {
+		return
+	}
+
+	var cps []*columnPatterns
+	versions, unknown := collectColumnPatterns(p.fields, &cps)
+
+	if unknown {
+		// every column is read into the field tagged as unknown
+		cps = []*columnPatterns{{patterns: []string{".*"}}}
+	}
+
+	if len(cps) == 0 {
+		err = fmt.Errorf("cloth: columns are not found, %v", i)
+		return
+	}
+
+	fs := make([]bigtable.Filter, 0, len(cps))
+	for _, cp := range cps {
+
+		var cf bigtable.Filter
+		if !cp.all {
+			cf = bigtable.ColumnFilter("(?:" + strings.Join(cp.patterns, "|") + ")")
+		}
+
+		switch {
+		case cp.family == "" && cf == nil:
+			fs = append(fs, bigtable.ColumnFilter(".*"))
+		case cp.family == "":
+			fs = append(fs, cf)
+		case cf == nil:
+			fs = append(fs, bigtable.FamilyFilter(regexp.QuoteMeta(cp.family)))
+		default:
+			fs = append(fs, bigtable.ChainFilters(bigtable.FamilyFilter(regexp.QuoteMeta(cp.family)), cf))
+		}
+	}
+
+	f = fs[0]
+	if len(fs) > 1 {
+		f = bigtable.InterleaveFilters(fs...)
+	}
+
+	if !versions {
+		f = bigtable.ChainFilters(f, bigtable.LatestNFilter(1))
+	}
+
+	return
+}
+
+// collect the column qualifier patterns of the fields by family,
+// and report whether a field is tagged as versions or unknown
+func collectColumnPatterns(fs []*fieldPlan, cps *[]*columnPatterns) (versions, unknown bool) {
+
+	for _, f := range fs {
+
+		ti := f.ti
+		if ti.Unknown {
+			unknown = true
+			continue
+		}
+
+		if ti.RowKey || ti.Column == "" {
+			continue
+		}
+
+		if ti.Versions {
+			versions = true
+		}
+
+		var cp *columnPatterns
+		for _, c := range *cps {
+			if c.family == ti.Family {
+				cp = c
+			}
+		}
+		if cp == nil {
+			cp = &columnPatterns{family: ti.Family}
+			*cps = append(*cps, cp)
+		}
+
+		p := regexp.QuoteMeta(ti.ColumnQualifier)
+		if f.isPrefix {
+			if f.prefix == "" {
+				cp.all = true
+			}
+			p = regexp.QuoteMeta(f.prefix) + ".*"
+		}
+
+		found := false
+		for _, q := range cp.patterns {
+			if q == p {
+				found = true
+			}
+		}
+		if !found {
+			cp.patterns = append(cp.patterns, p)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,116 @@
+package btawel_test
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+)
+
+func TestFilterFor(t *testing.T) {
+
+	t.Run("Filter string", func(t *testing.T) {
+		f, err := btawel.FilterFor(&Person{})
+
+		require.NoError(t, err)
+		require.Equal(t, `(((col(info:) | col(.*:(?:name|age))) + (col(address:) | col(.*:(?:address)))) | col(*,1))`, f.String())
+	})
+
+	t.Run("Unqualified columns of any family", func(t *testing.T) {
+		f, err := btawel.FilterFor(&struct {
+			ID   string `bigtable:",rowkey"`
+			Name string `bigtable:"name"`
+		}{})
+
+		require.NoError(t, err)
+		require.Equal(t, `(col(.*:(?:name)) | col(*,1))`, f.String())
+	})
+
+	t.Run("Error if columns are not found", func(t *testing.T) {
+		_, err := btawel.FilterFor(&struct {
+			ID string `bigtable:",rowkey"`
+		}{})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if nil", func(t *testing.T) {
+		_, err := btawel.FilterFor(nil)
+		require.Error(t, err)
+	})
+}
+
+func TestFilterForRead(t *testing.T) {
+
+	tbl, closer := newTestTable(t, "fc", "info", "address")
+	defer closer()
+
+	ctx := context.Background()
+	now := time.Unix(1538352000, 0)
+
+	m := bigtable.NewMutation()
+	m.Set("info", "name", bigtable.Time(now.Add(-time.Hour)), []byte("Old"))
+	m.Set("info", "name", bigtable.Time(now), []byte("John"))
+	m.Set("info", "age", bigtable.Time(now), []byte{0, 0, 0, 30})
+	m.Set("info", "email", bigtable.Time(now), []byte("john@example.com"))
+	m.Set("fc", "name", bigtable.Time(now), []byte("other family"))
+	m.Set("address", "address", bigtable.Time(now), []byte("Rafless st."))
+	m.Set("address", "address.old", bigtable.Time(now), []byte("Old st."))
+	require.NoError(t, tbl.Apply(ctx, "john", m))
+
+	t.Run("Only the newest version of the tagged columns", func(t *testing.T) {
+		f, err := btawel.FilterFor(&Person{})
+		require.NoError(t, err)
+
+		row, err := tbl.ReadRow(ctx, "john", bigtable.RowFilter(f))
+		require.NoError(t, err)
+
+		require.Len(t, row["info"], 2)
+		require.Len(t, row["address"], 1)
+		require.Empty(t, row["fc"])
+
+		var p Person
+		require.NoError(t, btawel.ReadRow(row, &p))
+		require.Equal(t, Person{Name: "John", Age: 30, Address: Address{Address: "Rafless st."}}, p)
+	})
+
+	t.Run("All versions of a versions field", func(t *testing.T) {
+		f, err := btawel.FilterFor(&struct {
+			Names []NameVersion `bigtable:"info:name, versions"`
+		}{})
+		require.NoError(t, err)
+
+		row, err := tbl.ReadRow(ctx, "john", bigtable.RowFilter(f))
+		require.NoError(t, err)
+		require.Len(t, row["info"], 2)
+	})
+
+	t.Run("Prefixed columns", func(t *testing.T) {
+		f, err := btawel.FilterFor(&struct {
+			Addresses map[string]string `bigtable:"address:address.*"`
+		}{})
+		require.NoError(t, err)
+
+		row, err := tbl.ReadRow(ctx, "john", bigtable.RowFilter(f))
+		require.NoError(t, err)
+		require.Len(t, row["address"], 1)
+		require.Equal(t, "address:address.old", row["address"][0].Column)
+	})
+
+	t.Run("Every column of any family", func(t *testing.T) {
+		f, err := btawel.FilterFor(&struct {
+			Attrs map[string]string `bigtable:"*"`
+		}{})
+		require.NoError(t, err)
+		require.Equal(t, `(col(.*:.*) | col(*,1))`, f.String())
+
+		row, err := tbl.ReadRow(ctx, "john", bigtable.RowFilter(f))
+		require.NoError(t, err)
+		require.Len(t, row["info"], 3)
+		require.Len(t, row["fc"], 1)
+		require.Len(t, row["address"], 2)
+	})
+}
@@ -3,7 +3,7 @@ module github.com/tvlk-data/btawel
 require (
 	cloud.google.com/go v0.28.0
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fatih/structs v1.0.0
+	github.com/golang/protobuf v1.2.0
 	github.com/google/btree v0.0.0-20180813153112-4030bb1f1f0c // indirect
 	github.com/google/go-cmp v0.2.0 // indirect
 	github.com/googleapis/gax-go v2.0.0+incompatible // indirect
@@ -0,0 +1,237 @@
+package btawel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// DecodeOptions are options of converting cells into a struct.
+type DecodeOptions struct {
+	// Strict checks that each cell is exactly the size of its field, such as 8 bytes for int64,
+	// and that each field is of a supported type.
+	// DecodeErrors of all fields failed in a row is returned instead of the first error.
+	Strict bool
+	// DisallowUnknownColumns returns UnknownColumnsError if a row has columns not mapped to any field.
+	DisallowUnknownColumns bool
+}
+
+// UnknownColumnsError is an error of the columns of a row not mapped to any field.
+type UnknownColumnsError struct {
+	RowKey string
+	// Columns are the unknown columns in "family:qualifier" form.
+	Columns []string
+}
+
+func (e *UnknownColumnsError) Error() string {
+	return fmt.Sprintf("cloth: row %q has unknown columns %s", e.RowKey, strings.Join(e.Columns, ", "))
+}
+
+// FieldError is an error of converting a cell into a field.
+type FieldError struct {
+	RowKey    string
+	Family    string
+	Qualifier string
+	// Field is a path of the field through nested structs such as "Address.Address",
+	// empty for an error of the parts of a composite row key.
+	Field string
+	// Type is a type of the field.
+	Type reflect.Type
+	// Length is a length of the cell value.
+	Length int
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+
+	if e.Field == "" {
+		return fmt.Sprintf("cloth: row %q: %v", e.RowKey, e.Err)
+	}
+
+	return fmt.Sprintf("cloth: row %q, column %s:%s, field %s of %v, %d bytes: %v",
+		e.RowKey, e.Family, e.Qualifier, e.Field, e.Type, e.Length, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors are the errors of all fields failed to convert in a row in the strict mode.
+type DecodeErrors []*FieldError
+
+func (es DecodeErrors) Error() string {
+
+	ss := make([]string, len(es))
+	for i, e := range es {
+		ss[i] = e.Error()
+	}
+
+	return strings.Join(ss, "; ")
+}
+
+// decoder converts the cells of a row into a struct by DecodeOptions.
+type decoder struct {
+	key  string
+	opts DecodeOptions
+	errs DecodeErrors
+	// used are the columns mapped to fields.
+	used map[string]bool
+}
+
+// decode calls fn converting the cells of column ris into a field.
+// The error is collected instead of returned in the strict mode.
+func (d *decoder) decode(f *fieldPlan, column string, ris []bigtable.ReadItem, fn func() error) error {
+
+	for _, ri := range ris {
+		d.used[ri.Column] = true
+	}
+
+	if d.opts.Strict {
+		failed := false
+		for _, ri := range ris {
+			if err := checkValue(f.typ, f.ti, ri.Value); err != nil {
+				d.check(f.name, f.typ, column, ri.Value, err)
+				failed = true
+			}
+		}
+		if failed {
+			return nil
+		}
+	}
+
+	var val []byte
+	if len(ris) == 1 {
+		val = ris[0].Value
+	}
+
+	return d.check(f.name, f.typ, column, val, fn())
+}
+
+// check returns err, or collects it as FieldError in the strict mode.
+func (d *decoder) check(path string, t reflect.Type, column string, val []byte, err error) error {
+
+	if err == nil || !d.opts.Strict {
+		return err
+	}
+
+	fm, q := splitColumn(column)
+	d.errs = append(d.errs, &FieldError{
+		RowKey:    d.key,
+		Family:    fm,
+		Qualifier: q,
+		Field:     path,
+		Type:      t,
+		Length:    len(val),
+		Err:       err,
+	})
+
+	return nil
+}
+
+// err returns the collected errors.
+func (d *decoder) err() error {
+
+	if len(d.errs) == 0 {
+		return nil
+	}
+
+	return d.errs
+}
+
+// readUnknown sets the newest cells of the columns of ris not mapped to any field into the field tagged as unknown,
+// and returns UnknownColumnsError if they are disallowed.
+func (d *decoder) readUnknown(ris []bigtable.ReadItem, v reflect.Value, p *structPlan) (err error) {
+
+	f := p.unknown
+	if f == nil && !d.opts.DisallowUnknownColumns {
+		return
+	}
+
+	if f != nil && f.typ != unknownType {
+		err = fmt.Errorf("cloth: unknown field should be map[string][]byte, %s", f.name)
+		return
+	}
+
+	var cols []string
+	var vals map[string][]byte
+	for _, ri := range latestItems(ris) {
+		if d.used[ri.Column] {
+			continue
+		}
+		if vals == nil {
+			vals = map[string][]byte{}
+		}
+		cols = append(cols, ri.Column)
+		vals[ri.Column] = ri.Value
+	}
+
+	if f != nil && vals != nil {
+		allocField(v, f.index).Set(reflect.ValueOf(vals))
+	}
+
+	if d.opts.DisallowUnknownColumns && len(cols) > 0 {
+		sort.Strings(cols)
+		err = &UnknownColumnsError{RowKey: d.key, Columns: cols}
+	}
+
+	return
+}
+
+// checkValue checks that val is exactly the size of a value of type t.
+func checkValue(t reflect.Type, ti TagInfo, val []byte) error {
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if ti.Encoding != "" || t != timeType && isValueType(t) {
+		return nil
+	}
+
+	if ti.Versions {
+		_, vf, err := versionFields(t)
+		if err != nil {
+			return err
+		}
+		ti.Versions = false
+		return checkValue(vf.Type, ti, val)
+	}
+
+	if _, ok := ti.qualifierPrefix(); ok && t.Kind() == reflect.Map {
+		return checkValue(t.Elem(), TagInfo{TimeFormat: ti.TimeFormat}, val)
+	}
+
+	var size int
+
+	switch {
+
+	case t == timeType:
+		if ti.TimeFormat == TimeFormatRFC3339 {
+			return nil
+		}
+		size = 8
+
+	case t.Kind() == reflect.Bool:
+		size = 1
+
+	case numberTypes[t.Kind()] != nil:
+		size = int(numberTypes[t.Kind()].Size())
+
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8,
+		t.Kind() == reflect.Map, t.Kind() == reflect.Struct, t.Kind() == reflect.Interface:
+		return fmt.Errorf("cloth: unsupported type. %v", t)
+
+	default:
+		return nil
+	}
+
+	if len(val) != size {
+		return fmt.Errorf("cloth: %v should be %d bytes, got %d", t, size, len(val))
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package btawel_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+)
+
+type Stats struct {
+	Count int32 `bigtable:"stats:count"`
+}
+
+type Score struct {
+	ID    string  `bigtable:",rowkey"`
+	Name  string  `bigtable:"fc:name"`
+	Score int64   `bigtable:"fc:score"`
+	Tags  []int   `bigtable:"fc:tags"`
+	Flag  bool    `bigtable:"fc:flag"`
+	Rate  float64 `bigtable:"fc:rate"`
+	Stats Stats
+}
+
+func TestReadStrict(t *testing.T) {
+
+	ris := []bigtable.ReadItem{
+		{Row: "john", Column: "fc:name", Value: []byte("John")},
+		{Row: "john", Column: "fc:score", Value: []byte{0, 0, 1}},
+		{Row: "john", Column: "fc:tags", Value: []byte{1, 2}},
+		{Row: "john", Column: "fc:flag", Value: []byte{}},
+		{Row: "john", Column: "fc:rate", Value: []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{Row: "john", Column: "stats:count", Value: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+	row := bigtable.Row{"fc": ris[:5], "stats": ris[5:]}
+
+	t.Run("ReadRow collects all errors", func(t *testing.T) {
+		var s Score
+		err := btawel.ReadRowWithOptions(row, &s, btawel.DecodeOptions{Strict: true})
+		require.Error(t, err)
+
+		es, ok := err.(btawel.DecodeErrors)
+		require.True(t, ok)
+		require.Len(t, es, 4)
+
+		require.Equal(t, "john", es[0].RowKey)
+		require.Equal(t, "fc", es[0].Family)
+		require.Equal(t, "score", es[0].Qualifier)
+		require.Equal(t, "Score", es[0].Field)
+		require.Equal(t, reflect.TypeOf(int64(0)), es[0].Type)
+		require.Equal(t, 3, es[0].Length)
+
+		require.Equal(t, "Tags", es[1].Field)
+		require.Equal(t, "Flag", es[2].Field)
+		require.Equal(t, "Stats.Count", es[3].Field)
+		require.Equal(t, 8, es[3].Length)
+
+		require.Equal(t, "John", s.Name, "the other fields are read")
+	})
+
+	t.Run("ReadItems collects all errors", func(t *testing.T) {
+		var s struct {
+			Score int64 `bigtable:"fc:score"`
+			Tags  []int `bigtable:"fc:tags"`
+			Rate  int32 `bigtable:"fc:rate"`
+		}
+		err := btawel.ReadItemsWithOptions(ris, &s, btawel.DecodeOptions{Strict: true})
+		require.Error(t, err)
+
+		es, ok := err.(btawel.DecodeErrors)
+		require.True(t, ok)
+		require.Len(t, es, 3)
+		require.Equal(t, "Rate", es[2].Field)
+	})
+
+	t.Run("No error if cells are valid", func(t *testing.T) {
+		var s Score
+		err := btawel.ReadRowWithOptions(bigtable.Row{"fc": ris[:1]}, &s, btawel.DecodeOptions{Strict: true})
+
+		require.NoError(t, err)
+		require.Equal(t, Score{ID: "john", Name: "John"}, s)
+	})
+
+	t.Run("Error of nested struct without strict", func(t *testing.T) {
+		var s Score
+		err := btawel.ReadRow(bigtable.Row{"stats": []bigtable.ReadItem{
+			{Row: "john", Column: "stats:count", Value: []byte{0}},
+		}}, &s)
+		require.Error(t, err)
+	})
+}
+
+type Customer struct {
+	ID      string            `bigtable:",rowkey"`
+	Name    string            `bigtable:"fc:name"`
+	Unknown map[string][]byte `bigtable:",unknown"`
+}
+
+func TestReadUnknownColumns(t *testing.T) {
+
+	ris := []bigtable.ReadItem{
+		{Row: "john", Column: "fc:name", Value: []byte("John")},
+		{Row: "john", Column: "fc:nickname", Value: []byte("Johnny"), Timestamp: 1},
+		{Row: "john", Column: "fc:nickname", Value: []byte("Jo"), Timestamp: 2},
+		{Row: "john", Column: "info:email", Value: []byte("john@example.com")},
+	}
+	row := bigtable.Row{"fc": ris[:3], "info": ris[3:]}
+
+	expected := Customer{
+		ID:   "john",
+		Name: "John",
+		Unknown: map[string][]byte{
+			"fc:nickname": []byte("Jo"),
+			"info:email":  []byte("john@example.com"),
+		},
+	}
+
+	t.Run("ReadRow into unknown field", func(t *testing.T) {
+		var p Customer
+		require.NoError(t, btawel.ReadRow(row, &p))
+		require.Equal(t, expected, p)
+	})
+
+	t.Run("ReadItems into unknown field", func(t *testing.T) {
+		var p Customer
+		require.NoError(t, btawel.ReadItems(ris, &p))
+		require.Equal(t, expected, p)
+	})
+
+	t.Run("Error if unknown columns are disallowed", func(t *testing.T) {
+		var p struct {
+			Name string `bigtable:"fc:name"`
+		}
+		err := btawel.ReadRowWithOptions(row, &p, btawel.DecodeOptions{DisallowUnknownColumns: true})
+		require.Error(t, err)
+
+		e, ok := err.(*btawel.UnknownColumnsError)
+		require.True(t, ok)
+		require.Equal(t, "john", e.RowKey)
+		require.Equal(t, []string{"fc:nickname", "info:email"}, e.Columns)
+
+		err = btawel.ReadRowWithOptions(bigtable.Row{"fc": ris[:1]}, &p, btawel.DecodeOptions{DisallowUnknownColumns: true})
+		require.NoError(t, err)
+	})
+
+	t.Run("Error if unknown field isn't map[string][]byte", func(t *testing.T) {
+		var p struct {
+			Unknown map[string]string `bigtable:",unknown"`
+		}
+		require.Error(t, btawel.ReadRow(row, &p))
+	})
+
+	t.Run("Unknown columns are written back", func(t *testing.T) {
+		tbl, closer := newTestTable(t, "fc", "info")
+		defer closer()
+
+		ctx := context.Background()
+		table := btawel.NewTable(tbl, "fc")
+
+		m := bigtable.NewMutation()
+		m.Set("fc", "name", bigtable.Time(time.Now()), []byte("John"))
+		m.Set("info", "email", bigtable.Time(time.Now()), []byte("john@example.com"))
+		require.NoError(t, tbl.Apply(ctx, "john", m))
+
+		var p Customer
+		require.NoError(t, table.Get(ctx, "john", &p))
+
+		p.Name = "Johnny"
+		require.NoError(t, table.Put(ctx, &p))
+
+		var got Customer
+		require.NoError(t, table.Get(ctx, "john", &got))
+		require.Equal(t, "Johnny", got.Name)
+		require.Equal(t, map[string][]byte{"info:email": []byte("john@example.com")}, got.Unknown)
+	})
+
+	t.Run("Columns named like options", func(t *testing.T) {
+		type Columns struct {
+			Unknown  string `bigtable:"unknown"`
+			Versions string `bigtable:"versions, omitempty"`
+			JSON     string `bigtable:"json, nullable"`
+			RFC3339  string `bigtable:"rfc3339 , omitempty"`
+		}
+		c := Columns{"a", "b", "c", "d"}
+
+		m, err := btawel.GenerateColumnsMutation("fc", time.Now(), &c)
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{
+			"fc:unknown":  []byte("a"),
+			"fc:versions": []byte("b"),
+			"fc:json":     []byte("c"),
+			"fc:rfc3339":  []byte("d"),
+		}, setCells(t, m))
+
+		var got Columns
+		require.NoError(t, btawel.ReadItems(applyMutations(t, "row", m)["fc"], &got))
+		require.Equal(t, c, got)
+	})
+
+	t.Run("Filter reads every column", func(t *testing.T) {
+		f, err := btawel.FilterFor(&Customer{})
+
+		require.NoError(t, err)
+		require.Equal(t, `(col(.*:(?:.*)) | col(*,1))`, f.String())
+	})
+}
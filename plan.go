@@ -0,0 +1,394 @@
+package btawel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fieldPlan is a field of a struct type compiled from its tag.
+type fieldPlan struct {
+	// name is a path of the field through nested structs such as "Address.Address".
+	name  string
+	index []int
+	typ   reflect.Type
+	ti    TagInfo
+	// prefix is the prefix of the column qualifiers of a map field tagged as "family:prefix*".
+	prefix   string
+	isPrefix bool
+	// ts is the field named by TagInfo.TimestampField.
+	ts *fieldPlan
+	// scope is the index of the nearest nested struct of the field which isn't embedded, nil for the top level.
+	// Only the fields in the same scope conflict with each other.
+	scope []int
+}
+
+// structPlan is a plan of converting a struct type compiled from its tags,
+// so that the tags are parsed only once for each type.
+type structPlan struct {
+	// fields are the fields of columns, the row key or the unknown columns in order, nested structs included.
+	fields []*fieldPlan
+	rowKey *fieldPlan
+	// rowKeyParts are the fields tagged as "rowkey=N" ordered by N.
+	rowKeyParts []*fieldPlan
+	// rowKeyDelimiter joins rowKeyParts.
+	rowKeyDelimiter string
+	rowKeyErr       error
+	unknown         *fieldPlan
+	versions        []*fieldPlan
+	prefixes        []*fieldPlan
+	// columns are the fields tagged as "family:qualifier" keyed by the column,
+	// qualifiers are the fields tagged without a family keyed by the qualifier.
+	columns    map[string][]*fieldPlan
+	qualifiers map[string][]*fieldPlan
+	// columnQualifiers are the fields tagged as qualifier.
+	columnQualifiers []*fieldPlan
+	err              error
+}
+
+// plans caches *structPlan by reflect.Type.
+var plans sync.Map
+
+// planOf returns the plan of a struct type.
+func planOf(t reflect.Type) (*structPlan, error) {
+
+	if p, ok := plans.Load(t); ok {
+		return p.(*structPlan), p.(*structPlan).err
+	}
+
+	p := &structPlan{
+		columns:    map[string][]*fieldPlan{},
+		qualifiers: map[string][]*fieldPlan{},
+	}
+
+	var fs []*fieldPlan
+	if p.err = p.compile(t, nil, "", nil, map[reflect.Type]bool{t: true}, &fs); p.err == nil {
+		p.classify(dominantFields(fs))
+	}
+
+	v, _ := plans.LoadOrStore(t, p)
+
+	return v.(*structPlan), v.(*structPlan).err
+}
+
+// compile adds the fields of a struct type at index into fs.
+// Like encoding/json, the fields of an embedded struct or an embedded pointer to struct are promoted
+// and unexported fields are skipped. scope is the index of the nearest nested struct which isn't embedded,
+// and visiting are the struct types being compiled to stop at a recursive type.
+func (p *structPlan) compile(t reflect.Type, index []int, path string, scope []int, visiting map[reflect.Type]bool, fs *[]*fieldPlan) (err error) {
+
+	for i := 0; i < t.NumField(); i++ {
+
+		sf := t.Field(i)
+
+		et := sf.Type
+		if sf.Anonymous && et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		embedded := sf.Anonymous && et.Kind() == reflect.Struct
+
+		if sf.PkgPath != "" && (!embedded || sf.Type.Kind() == reflect.Ptr) {
+			// unexported, or an unexported pointer which can't be allocated
+			continue
+		}
+
+		f := &fieldPlan{
+			name:  sf.Name,
+			index: append(append([]int(nil), index...), i),
+			typ:   sf.Type,
+			ti:    GetBigtableTagInfo(sf.Tag.Get(BigtableTagName)),
+			scope: scope,
+		}
+		if path != "" {
+			f.name = path + "." + sf.Name
+		}
+
+		if f.ti.Ignore {
+			continue
+		}
+
+		if embedded && sf.Type.Kind() == reflect.Ptr && isNestedType(et, f.ti) {
+			if visiting[et] {
+				continue
+			}
+			visiting[et] = true
+			err = p.compile(et, f.index, path, scope, visiting, fs)
+			delete(visiting, et)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if isNestedType(f.typ, f.ti) && !f.ti.RowKey {
+			np, ns := f.name, f.index
+			if embedded {
+				np, ns = path, scope
+			}
+			if err = p.compile(f.typ, f.index, np, ns, visiting, fs); err != nil {
+				return
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			// an unexported embedded struct stored by a marshaler or an encoding
+			continue
+		}
+
+		ti := f.ti
+		if ti.Qualifier {
+			p.columnQualifiers = append(p.columnQualifiers, f)
+			continue
+		}
+
+		if !ti.RowKey && !ti.Unknown && ti.Column == "" {
+			continue
+		}
+
+		if ti.TimestampField != "" {
+			tf, ok := t.FieldByName(ti.TimestampField)
+			if !ok {
+				err = fmt.Errorf("cloth: timestamp field %s is not found", ti.TimestampField)
+				return
+			}
+			f.ts = &fieldPlan{
+				name:  tf.Name,
+				index: append(append([]int(nil), index...), tf.Index...),
+				typ:   tf.Type,
+			}
+		}
+
+		f.prefix, f.isPrefix = ti.qualifierPrefix()
+		*fs = append(*fs, f)
+	}
+
+	return
+}
+
+// classify sets the fields into the plan by their tags.
+func (p *structPlan) classify(fs []*fieldPlan) {
+
+	p.fields = fs
+
+	for _, f := range fs {
+
+		ti := f.ti
+
+		switch {
+
+		case ti.RowKey:
+			if ti.RowKeyIndex < 0 && p.rowKeyErr == nil {
+				p.rowKeyErr = fmt.Errorf("cloth: rowkey=N should be a positive number, %s", f.name)
+			}
+			if ti.RowKeyIndex != 0 {
+				p.rowKeyParts = append(p.rowKeyParts, f)
+			} else if p.rowKey == nil {
+				p.rowKey = f
+			}
+
+		case ti.Unknown:
+			if p.unknown == nil {
+				p.unknown = f
+			}
+
+		case ti.Versions:
+			p.versions = append(p.versions, f)
+
+		case f.isPrefix:
+			p.prefixes = append(p.prefixes, f)
+
+		case ti.Family != "":
+			p.columns[ti.Column] = append(p.columns[ti.Column], f)
+
+		default:
+			p.qualifiers[ti.Column] = append(p.qualifiers[ti.Column], f)
+		}
+	}
+
+	sort.SliceStable(p.rowKeyParts, func(i, j int) bool {
+		return p.rowKeyParts[i].ti.RowKeyIndex < p.rowKeyParts[j].ti.RowKeyIndex
+	})
+	for i := 1; i < len(p.rowKeyParts) && p.rowKeyErr == nil; i++ {
+		if a, b := p.rowKeyParts[i-1], p.rowKeyParts[i]; a.ti.RowKeyIndex == b.ti.RowKeyIndex {
+			p.rowKeyErr = fmt.Errorf("cloth: rowkey=%d is duplicated, %s and %s", b.ti.RowKeyIndex, a.name, b.name)
+		}
+	}
+
+	p.rowKeyDelimiter = RowKeyDelimiter
+	var delimited *fieldPlan
+	for _, f := range p.rowKeyParts {
+		switch d := f.ti.RowKeyDelimiter; {
+		case d == "":
+		case delimited == nil:
+			p.rowKeyDelimiter, delimited = d, f
+		case d != p.rowKeyDelimiter && p.rowKeyErr == nil:
+			p.rowKeyErr = fmt.Errorf("cloth: delim=%s conflicts with delim=%s, %s and %s", d, p.rowKeyDelimiter, delimited.name, f.name)
+		}
+	}
+}
+
+// dominantFields drops the fields promoted through embedded structs hidden by another field of the same column
+// in the same scope like encoding/json. The fields of the shallowest struct win,
+// and they are all dropped if the embedded structs of the same depth conflict.
+// The fields of a struct can share a column, and the versions of a column don't conflict with its newest value.
+func dominantFields(fs []*fieldPlan) []*fieldPlan {
+
+	type dominant struct {
+		depth     int
+		parent    string
+		ambiguous bool
+	}
+
+	ds := map[string]*dominant{}
+	for _, f := range fs {
+		k, ok := f.conflictKey()
+		if !ok {
+			continue
+		}
+		parent := fmt.Sprint(f.index[:len(f.index)-1])
+		switch d := ds[k]; {
+		case d == nil || len(f.index) < d.depth:
+			ds[k] = &dominant{depth: len(f.index), parent: parent}
+		case len(f.index) == d.depth && parent != d.parent:
+			d.ambiguous = true
+		}
+	}
+
+	ret := make([]*fieldPlan, 0, len(fs))
+	for _, f := range fs {
+		k, ok := f.conflictKey()
+		if !ok {
+			ret = append(ret, f)
+			continue
+		}
+		if d := ds[k]; len(f.index) == d.depth && !d.ambiguous {
+			ret = append(ret, f)
+		}
+	}
+
+	return ret
+}
+
+// conflictKey returns the key of the fields conflicting with each other, or false for the row key and the unknown columns.
+func (f *fieldPlan) conflictKey() (string, bool) {
+
+	if f.ti.RowKey || f.ti.Unknown {
+		return "", false
+	}
+
+	k := fmt.Sprint(f.scope, " ", f.ti.Column)
+	if f.ti.Versions {
+		k += ",versions"
+	}
+
+	return k, true
+}
+
+// readItemFields calls fn for the fields of a column in "family:qualifier" form except versions.
+func (p *structPlan) readItemFields(column string, fn func(f *fieldPlan) error) (err error) {
+
+	for _, f := range p.columns[column] {
+		if err = fn(f); err != nil {
+			return
+		}
+	}
+
+	for _, f := range p.qualifiers[column[strings.LastIndex(column, ColumnQualifierDelimiter)+1:]] {
+		if err = fn(f); err != nil {
+			return
+		}
+	}
+
+	if len(p.prefixes) == 0 {
+		return
+	}
+
+	fm, q := splitColumn(column)
+	for _, f := range p.prefixes {
+		if f.ti.Family != "" && fm != f.ti.Family || !strings.HasPrefix(q, f.prefix) {
+			continue
+		}
+		if err = fn(f); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// structOf returns the struct value of i, which is a struct or a non-nil pointer to struct, and its plan.
+func structOf(i interface{}) (v reflect.Value, p *structPlan, err error) {
+
+	v = reflect.ValueOf(i)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			err = fmt.Errorf("cloth: %T should not be nil", i)
+			return
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		err = fmt.Errorf("cloth: %T should be a struct or a pointer to struct", i)
+		return
+	}
+
+	p, err = planOf(v.Type())
+
+	return
+}
+
+// structPtrOf returns the struct value i points to and its plan.
+func structPtrOf(i interface{}) (v reflect.Value, p *structPlan, err error) {
+
+	v = reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		err = fmt.Errorf("cloth: %T should be a non-nil pointer to struct", i)
+		return
+	}
+
+	v = v.Elem()
+	p, err = planOf(v.Type())
+
+	return
+}
+
+// lookupField returns the field of v at index, or false if a pointer to an embedded struct on the way is nil.
+func lookupField(v reflect.Value, index []int) (reflect.Value, bool) {
+
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	return v, true
+}
+
+// allocField returns the field of v at index, allocating the nil pointers to embedded structs on the way.
+func allocField(v reflect.Value, index []int) reflect.Value {
+
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	return v
+}
+
+// isZero reports whether v is the zero value of its type.
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
@@ -0,0 +1,332 @@
+package btawel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+)
+
+type Order struct {
+	ID        string    `bigtable:",rowkey"`
+	UserID    string    `bigtable:"fc:userId"`
+	Item      string    `bigtable:"fc:item"`
+	Quantity  int32     `bigtable:"fc:quantity"`
+	Price     float64   `bigtable:"fc:price"`
+	Paid      bool      `bigtable:"fc:paid"`
+	Note      string    `bigtable:"fc:note, omitempty"`
+	CreatedAt time.Time `bigtable:"fc:createdAt"`
+	UpdatedAt time.Time `bigtable:"fc:updatedAt"`
+	Address   Address
+}
+
+func newOrderRow(b *testing.B) (Order, bigtable.Row) {
+
+	o := Order{
+		ID:        "order#1",
+		UserID:    "john",
+		Item:      "ticket",
+		Quantity:  2,
+		Price:     120.5,
+		Paid:      true,
+		CreatedAt: time.Unix(1538352000, 0),
+		UpdatedAt: time.Unix(1538352100, 0),
+		Address:   Address{Address: "Rafless st."},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &o)
+	require.NoError(b, err)
+
+	return o, applyMutations(b, o.ID, m)
+}
+
+func TestPlanConcurrent(t *testing.T) {
+
+	o := Order{
+		ID:        "order#1",
+		UserID:    "john",
+		Quantity:  2,
+		CreatedAt: time.Unix(1538352000, 0),
+		UpdatedAt: time.Unix(1538352100, 0),
+		Address:   Address{Address: "Rafless st."},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &o)
+	require.NoError(t, err)
+
+	var ris []bigtable.ReadItem
+	for c, v := range setCells(t, m) {
+		ris = append(ris, bigtable.ReadItem{Row: o.ID, Column: c, Value: v})
+	}
+
+	// require can't be called from the goroutines
+	ms := make([]*bigtable.Mutation, 8)
+	gots := make([]Order, 8)
+	errs := make([]error, 16)
+
+	var wg sync.WaitGroup
+	for i := range ms {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ms[i], errs[2*i] = btawel.GenerateColumnsMutation("", time.Now(), &o)
+			errs[2*i+1] = btawel.ReadItems(ris, &gots[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range ms {
+		require.NoError(t, errs[2*i])
+		require.NoError(t, errs[2*i+1])
+
+		require.Equal(t, setCells(t, m), setCells(t, ms[i]))
+		require.True(t, o.CreatedAt.Equal(gots[i].CreatedAt))
+		require.Equal(t, o.Quantity, gots[i].Quantity)
+	}
+}
+
+type audit struct {
+	UpdatedBy string `bigtable:"fc:updatedBy"`
+}
+
+type Base struct {
+	CreatedAt time.Time `bigtable:"fc:createdAt"`
+	UpdatedAt time.Time `bigtable:"fc:updatedAt"`
+	Version   int64     `bigtable:"fc:version"`
+}
+
+type Article struct {
+	ID    string `bigtable:",rowkey"`
+	Title string `bigtable:"fc:title"`
+	Base
+	audit
+	secret string `bigtable:"fc:secret"`
+}
+
+func TestEmbeddedStruct(t *testing.T) {
+
+	a := Article{
+		ID:     "article#1",
+		Title:  "Hello",
+		Base:   Base{CreatedAt: time.Unix(1538352000, 0), Version: 2},
+		audit:  audit{UpdatedBy: "john"},
+		secret: "WRYYY!",
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &a)
+	require.NoError(t, err)
+
+	cs := setCells(t, m)
+	require.Len(t, cs, 5, "unexported field is skipped")
+	require.Equal(t, []byte("john"), cs["fc:updatedBy"])
+
+	t.Run("Round trip", func(t *testing.T) {
+		var ris []bigtable.ReadItem
+		for c, v := range cs {
+			ris = append(ris, bigtable.ReadItem{Row: a.ID, Column: c, Value: v})
+		}
+
+		var got Article
+		require.NoError(t, btawel.ReadItems(ris, &got))
+
+		require.Equal(t, a.Title, got.Title)
+		require.True(t, a.CreatedAt.Equal(got.CreatedAt))
+		require.Equal(t, a.Version, got.Version)
+		require.Equal(t, a.UpdatedBy, got.UpdatedBy)
+		require.Empty(t, got.secret)
+	})
+
+	t.Run("Promoted field name", func(t *testing.T) {
+		m, err := btawel.GenerateSelectedColumnsMutation("", time.Now(), &a, "Version")
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"fc:version": cs["fc:version"]}, setCells(t, m))
+	})
+}
+
+type Comment struct {
+	ID   string `bigtable:",rowkey"`
+	Body string `bigtable:"fc:body"`
+	*Base
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+
+	t.Run("Nil is omitted", func(t *testing.T) {
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &Comment{ID: "comment#1", Body: "Nice"})
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"fc:body": []byte("Nice")}, setCells(t, m))
+	})
+
+	t.Run("Allocated on demand", func(t *testing.T) {
+		c := Comment{ID: "comment#1", Body: "Nice", Base: &Base{Version: 3}}
+
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &c)
+		require.NoError(t, err)
+
+		row := bigtable.Row{}
+		for col, v := range setCells(t, m) {
+			row["fc"] = append(row["fc"], bigtable.ReadItem{Row: c.ID, Column: col, Value: v})
+		}
+
+		var got Comment
+		require.NoError(t, btawel.ReadRow(row, &got))
+		require.NotNil(t, got.Base)
+		require.Equal(t, int64(3), got.Version)
+
+		got = Comment{}
+		require.NoError(t, btawel.ReadItems(row["fc"], &got))
+		require.NotNil(t, got.Base)
+		require.Equal(t, int64(3), got.Version)
+	})
+
+	t.Run("Nil without cells", func(t *testing.T) {
+		row := bigtable.Row{"fc": []bigtable.ReadItem{
+			{Row: "comment#1", Column: "fc:body", Value: []byte("Nice")},
+		}}
+
+		var got Comment
+		require.NoError(t, btawel.ReadRow(row, &got))
+		require.Equal(t, Comment{ID: "comment#1", Body: "Nice"}, got)
+	})
+
+	t.Run("Recursive type", func(t *testing.T) {
+		type Node struct {
+			Name string `bigtable:"fc:name"`
+			*Node
+		}
+
+		m, err := btawel.GenerateColumnsMutation("", time.Now(), &Node{Name: "a", Node: &Node{Name: "b"}})
+
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"fc:name": []byte("a")}, setCells(t, m))
+	})
+}
+
+type Trail struct {
+	UpdatedAt time.Time `bigtable:"fc:updatedAt"`
+	Version   int64     `bigtable:"fc:version"`
+}
+
+type Post struct {
+	ID      string `bigtable:",rowkey"`
+	Version string `bigtable:"fc:version"`
+	Base
+	Trail
+}
+
+func TestEmbeddedConflict(t *testing.T) {
+
+	p := Post{
+		ID:      "post#1",
+		Version: "v1",
+		Base:    Base{CreatedAt: time.Unix(1538352000, 0), UpdatedAt: time.Unix(1538352100, 0), Version: 2},
+		Trail:   Trail{UpdatedAt: time.Unix(1538352200, 0), Version: 3},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &p)
+	require.NoError(t, err)
+
+	cs := setCells(t, m)
+	require.Len(t, cs, 2, "updatedAt of the same depth is dropped")
+	require.Equal(t, []byte("v1"), cs["fc:version"], "the shallowest field wins")
+	require.Contains(t, cs, "fc:createdAt")
+
+	var got Post
+	require.NoError(t, btawel.ReadItems([]bigtable.ReadItem{
+		{Row: p.ID, Column: "fc:version", Value: []byte("v2")},
+		{Row: p.ID, Column: "fc:updatedAt", Value: make([]byte, 8)},
+	}, &got))
+	require.Equal(t, Post{ID: p.ID, Version: "v2"}, got)
+}
+
+func TestNestedStructSameColumn(t *testing.T) {
+
+	var s struct {
+		Home Address
+		Work Address
+	}
+
+	row := bigtable.Row{"address": []bigtable.ReadItem{
+		{Row: "john", Column: "address:address", Value: []byte("Rafless st.")},
+	}}
+	require.NoError(t, btawel.ReadRow(row, &s))
+	require.Equal(t, "Rafless st.", s.Home.Address, "named nested structs don't conflict")
+	require.Equal(t, "Rafless st.", s.Work.Address)
+
+	s.Work.Address = "Orchard rd."
+	m, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"address:address": []byte("Orchard rd.")}, setCells(t, m))
+}
+
+func TestInvalidStruct(t *testing.T) {
+
+	var nilPtr *Article
+	for _, i := range []interface{}{42, map[string]string{}, nilPtr} {
+
+		_, err := btawel.GenerateColumnsMutation("fc", time.Now(), i)
+		require.Error(t, err)
+
+		_, err = btawel.GetRowKey(i)
+		require.Error(t, err)
+
+		_, err = btawel.FilterFor(i)
+		require.Error(t, err)
+	}
+}
+
+func BenchmarkGenerateRowMutation(b *testing.B) {
+
+	o, _ := newOrderRow(b)
+	t := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, err := btawel.GenerateRowMutation("", t, &o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadRow(b *testing.B) {
+
+	_, row := newOrderRow(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var o Order
+		if err := btawel.ReadRow(row, &o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadItems(b *testing.B) {
+
+	_, row := newOrderRow(b)
+
+	var ris []bigtable.ReadItem
+	for _, items := range row {
+		ris = append(ris, items...)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var o Order
+		if err := btawel.ReadItems(ris, &o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
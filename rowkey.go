@@ -0,0 +1,239 @@
+package btawel
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetRowKey gets a row key from the field tagged as rowkey.
+// Fields tagged as "rowkey=N" are joined in order of N by RowKeyDelimiter, or by X of a part tagged with "delim=X".
+// An error is returned if the field is not found or empty.
+func GetRowKey(i interface{}) (key string, err error) {
+
+	if i == nil {
+		err = fmt.Errorf("cloth: struct should not be nil")
+		return
+	}
+
+	v, p, err := structOf(i)
+	if err != nil {
+		return
+	}
+
+	if p.rowKeyErr != nil {
+		err = p.rowKeyErr
+		return
+	}
+
+	if len(p.rowKeyParts) > 0 {
+		key, err = encodeRowKey(v, p.rowKeyParts, p.rowKeyDelimiter)
+		return
+	}
+
+	f := p.rowKey
+	if f == nil {
+		err = fmt.Errorf("cloth: rowkey field is not found, %v", i)
+		return
+	}
+
+	fv, ok := lookupField(v, f.index)
+	if ok && fv.Kind() == reflect.Ptr {
+		// a nil pointer is empty
+		if ok = !fv.IsNil(); ok {
+			fv = fv.Elem()
+		}
+	}
+	if !ok {
+		err = fmt.Errorf("cloth: rowkey should not be empty, %s", f.name)
+		return
+	}
+
+	switch fv := fv.Interface().(type) {
+	case string:
+		key = fv
+	case []byte:
+		key = string(fv)
+	default:
+		err = fmt.Errorf("cloth: unsupported rowkey type. %v", f.typ.Kind())
+		return
+	}
+
+	if key == "" {
+		err = fmt.Errorf("cloth: rowkey should not be empty, %s", f.name)
+	}
+
+	return
+}
+
+// encodeRowKey joins the parts of a composite row key.
+func encodeRowKey(v reflect.Value, ps []*fieldPlan, delim string) (key string, err error) {
+
+	ss := make([]string, len(ps))
+	for i, p := range ps {
+
+		if fv, ok := lookupField(v, p.index); ok {
+			if ss[i], err = encodeRowKeyPart(fv, p); err != nil {
+				return
+			}
+		}
+
+		if ss[i] == "" {
+			err = fmt.Errorf("cloth: rowkey should not be empty, %s", p.name)
+			return
+		}
+
+		if i < len(ps)-1 && strings.Contains(ss[i], delim) {
+			err = fmt.Errorf("cloth: rowkey part should not contain %q, %s", delim, p.name)
+			return
+		}
+	}
+
+	key = strings.Join(ss, delim)
+
+	return
+}
+
+// decodeRowKey splits a composite row key into its parts.
+func decodeRowKey(key string, v reflect.Value, ps []*fieldPlan, delim string) (err error) {
+
+	if len(ps) == 0 {
+		return
+	}
+
+	ss := strings.SplitN(key, delim, len(ps))
+	if len(ss) != len(ps) {
+		err = fmt.Errorf("cloth: rowkey %q should have %d parts", key, len(ps))
+		return
+	}
+
+	for i, p := range ps {
+		if err = decodeRowKeyPart(allocField(v, p.index), p, ss[i]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func encodeRowKeyPart(v reflect.Value, p *fieldPlan) (s string, err error) {
+
+	if v.Type() == timeType {
+		// as Unix time in nanoseconds
+		v = reflect.ValueOf(v.Interface().(time.Time).UnixNano())
+	}
+
+	switch v.Kind() {
+
+	case reflect.String:
+		s = v.String()
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte
+			s = string(v.Bytes())
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		if n < 0 {
+			err = fmt.Errorf("cloth: rowkey should not be negative, %s", p.name)
+			return
+		}
+		if p.ti.Reverse {
+			n = maxInt(v.Type().Bits()) - n
+		}
+		s = fmt.Sprintf("%0*d", digits(uint64(maxInt(v.Type().Bits()))), n)
+		return
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := v.Uint()
+		if p.ti.Reverse {
+			n = maxUint(v.Type().Bits()) - n
+		}
+		s = fmt.Sprintf("%0*d", digits(maxUint(v.Type().Bits())), n)
+		return
+
+	default:
+		err = fmt.Errorf("cloth: unsupported rowkey type. %v", v.Kind())
+		return
+	}
+
+	if p.ti.Reverse {
+		err = fmt.Errorf("cloth: reverse is only for integer rowkey, %s", p.name)
+	}
+
+	return
+}
+
+func decodeRowKeyPart(fv reflect.Value, p *fieldPlan, s string) (err error) {
+
+	v := reflect.New(fv.Type()).Elem()
+	if v.Type() == timeType {
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return
+		}
+		if p.ti.Reverse {
+			n = math.MaxInt64 - n
+		}
+		fv.Set(reflect.ValueOf(time.Unix(0, n)))
+		return
+	}
+
+	switch v.Kind() {
+
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cloth: unsupported rowkey type. %v", v.Kind())
+		}
+		// []byte
+		v.SetBytes([]byte(s))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, v.Type().Bits()); err != nil {
+			return
+		}
+		if p.ti.Reverse {
+			n = maxInt(v.Type().Bits()) - n
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, v.Type().Bits()); err != nil {
+			return
+		}
+		if p.ti.Reverse {
+			n = maxUint(v.Type().Bits()) - n
+		}
+		v.SetUint(n)
+
+	default:
+		return fmt.Errorf("cloth: unsupported rowkey type. %v", v.Kind())
+	}
+
+	fv.Set(v)
+
+	return
+}
+
+func maxInt(bits int) int64 {
+	return math.MaxInt64 >> uint(64-bits)
+}
+
+func maxUint(bits int) uint64 {
+	return math.MaxUint64 >> uint(64-bits)
+}
+
+// digits returns the number of decimal digits of n.
+func digits(n uint64) int {
+	return len(strconv.FormatUint(n, 10))
+}
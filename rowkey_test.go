@@ -0,0 +1,217 @@
+package btawel_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+)
+
+type Event struct {
+	Tenant    string `bigtable:",rowkey=1"`
+	UserID    uint32 `bigtable:",rowkey=2"`
+	Timestamp int64  `bigtable:",rowkey=3,reverse"`
+	Name      string `bigtable:"fc:name"`
+}
+
+func TestGetRowKeyComposite(t *testing.T) {
+
+	e := Event{
+		Tenant:    "traveloka",
+		UserID:    42,
+		Timestamp: 1538352000,
+	}
+
+	key, err := btawel.GetRowKey(&e)
+
+	require.NoError(t, err)
+	require.Equal(t, "traveloka#0000000042#9223372035316423807", key)
+
+	t.Run("Newer timestamp sorts first", func(t *testing.T) {
+		newer := e
+		newer.Timestamp++
+
+		k, err := btawel.GetRowKey(&newer)
+		require.NoError(t, err)
+		require.True(t, k < key)
+	})
+
+	t.Run("Parts are ordered by index", func(t *testing.T) {
+		key, err := btawel.GetRowKey(&struct {
+			B string `bigtable:",rowkey=2"`
+			A string `bigtable:",rowkey=1"`
+		}{"b", "a"})
+
+		require.NoError(t, err)
+		require.Equal(t, "a#b", key)
+	})
+
+	t.Run("Delimiter of type", func(t *testing.T) {
+		type Visit struct {
+			A string `bigtable:",rowkey=1, delim=|"`
+			B string `bigtable:",rowkey=2"`
+		}
+
+		key, err := btawel.GetRowKey(&Visit{"a#1", "b"})
+		require.NoError(t, err)
+		require.Equal(t, "a#1|b", key)
+
+		var got Visit
+		require.NoError(t, btawel.ReadItems([]bigtable.ReadItem{{Row: key}}, &got))
+		require.Equal(t, Visit{"a#1", "b"}, got)
+	})
+
+	t.Run("Error if part is empty", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&Event{UserID: 42})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if part contains delimiter", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&Event{Tenant: "a#b"})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if part is negative", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&Event{Tenant: "traveloka", Timestamp: -1})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if index is duplicated", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&struct {
+			A string `bigtable:",rowkey=1"`
+			B string `bigtable:",rowkey=1"`
+		}{"a", "b"})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if index isn't a positive number", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&struct {
+			A string `bigtable:",rowkey=x"`
+			B string `bigtable:",rowkey=1"`
+		}{"a", "b"})
+		require.Error(t, err)
+
+		_, err = btawel.GetRowKey(&struct {
+			A string `bigtable:",rowkey=0"`
+		}{"a"})
+		require.Error(t, err)
+
+		require.Error(t, btawel.ReadItems([]bigtable.ReadItem{{Row: "a#b"}}, &struct {
+			A string `bigtable:",rowkey=x"`
+		}{}))
+	})
+
+	t.Run("Error if delimiters conflict", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&struct {
+			A string `bigtable:",rowkey=1, delim=|"`
+			B string `bigtable:",rowkey=2, delim=/"`
+		}{"a", "b"})
+		require.Error(t, err)
+	})
+
+	t.Run("Error if string is reversed", func(t *testing.T) {
+		_, err := btawel.GetRowKey(&struct {
+			A string `bigtable:",rowkey=1,reverse"`
+		}{"a"})
+		require.Error(t, err)
+	})
+}
+
+func TestReadRowKeyComposite(t *testing.T) {
+
+	key := "traveloka#0000000042#9223372035316423807"
+	ris := []bigtable.ReadItem{
+		bigtable.ReadItem{
+			Row:    key,
+			Column: "fc:name",
+			Value:  []byte("login"),
+		},
+	}
+	expected := Event{
+		Tenant:    "traveloka",
+		UserID:    42,
+		Timestamp: 1538352000,
+		Name:      "login",
+	}
+
+	t.Run("ReadRow", func(t *testing.T) {
+		var e Event
+		err := btawel.ReadRow(bigtable.Row{"fc": ris}, &e)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, e)
+	})
+
+	t.Run("ReadItems", func(t *testing.T) {
+		var e Event
+		err := btawel.ReadItems(ris, &e)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, e)
+	})
+
+	t.Run("Last part can contain delimiter", func(t *testing.T) {
+		var s struct {
+			A string `bigtable:",rowkey=1"`
+			B string `bigtable:",rowkey=2"`
+		}
+		err := btawel.ReadItems([]bigtable.ReadItem{{Row: "a#b#c"}}, &s)
+
+		require.NoError(t, err)
+		require.Equal(t, "a", s.A)
+		require.Equal(t, "b#c", s.B)
+	})
+
+	t.Run("Round trip of maximum values", func(t *testing.T) {
+		s := struct {
+			A int8   `bigtable:",rowkey=1,reverse"`
+			B uint64 `bigtable:",rowkey=2"`
+			C int    `bigtable:",rowkey=3"`
+		}{math.MaxInt8, math.MaxUint64, math.MaxInt64}
+
+		key, err := btawel.GetRowKey(&s)
+		require.NoError(t, err)
+
+		var got struct {
+			A int8   `bigtable:",rowkey=1,reverse"`
+			B uint64 `bigtable:",rowkey=2"`
+			C int    `bigtable:",rowkey=3"`
+		}
+		require.NoError(t, btawel.ReadItems([]bigtable.ReadItem{{Row: key}}, &got))
+		require.Equal(t, s, got)
+	})
+
+	t.Run("Error if parts are missing", func(t *testing.T) {
+		var e Event
+		err := btawel.ReadItems([]bigtable.ReadItem{{Row: "traveloka"}}, &e)
+		require.Error(t, err)
+	})
+
+	t.Run("Error if part isn't a number", func(t *testing.T) {
+		var e Event
+		err := btawel.ReadItems([]bigtable.ReadItem{{Row: "traveloka#abc#1"}}, &e)
+		require.Error(t, err)
+	})
+}
+
+func TestRowKeyTime(t *testing.T) {
+
+	type Log struct {
+		UserID    string    `bigtable:",rowkey=1"`
+		Timestamp time.Time `bigtable:",rowkey=2,reverse"`
+	}
+
+	l := Log{UserID: "john", Timestamp: time.Unix(1538352000, 123)}
+
+	key, err := btawel.GetRowKey(&l)
+	require.NoError(t, err)
+	require.Equal(t, "john#7685020036854775684", key)
+
+	var got Log
+	require.NoError(t, btawel.ReadItems([]bigtable.ReadItem{{Row: key}}, &got))
+	require.Equal(t, l.UserID, got.UserID)
+	require.True(t, l.Timestamp.Equal(got.Timestamp))
+}
@@ -0,0 +1,156 @@
+package btawel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// ErrNotFound is returned by Table.Get when the row doesn't exist.
+var ErrNotFound = errors.New("cloth: row is not found")
+
+// Table loads and saves structs directly against bigtable.Table.
+type Table struct {
+	tbl    *bigtable.Table
+	family string
+	opts   DecodeOptions
+}
+
+// NewTable returns Table wrapping tbl.
+// family is used for the fields tagged without a family, and can be empty if every field has one.
+func NewTable(tbl *bigtable.Table, family string) *Table {
+	return &Table{
+		tbl:    tbl,
+		family: family,
+	}
+}
+
+// WithDecodeOptions returns a copy of Table reading rows by opts.
+func (t *Table) WithDecodeOptions(opts DecodeOptions) *Table {
+
+	c := *t
+	c.opts = opts
+
+	return &c
+}
+
+// Put writes a struct into the row of its rowkey field.
+func (t *Table) Put(ctx context.Context, i interface{}) (err error) {
+
+	key, m, err := GenerateRowMutation(t.family, time.Now(), i)
+	if err != nil {
+		return
+	}
+
+	err = t.tbl.Apply(ctx, key, m)
+
+	return
+}
+
+// Update writes only the selected fields of a struct into the row of its rowkey field, see SetSelectedColumns.
+func (t *Table) Update(ctx context.Context, i interface{}, names ...string) (err error) {
+
+	key, err := GetRowKey(i)
+	if err != nil {
+		return
+	}
+
+	m, err := GenerateSelectedColumnsMutation(t.family, time.Now(), i, names...)
+	if err != nil {
+		return
+	}
+
+	err = t.tbl.Apply(ctx, key, m)
+
+	return
+}
+
+// Get reads the row of key into a struct.
+// ErrNotFound is returned if the row doesn't exist.
+func (t *Table) Get(ctx context.Context, key string, s interface{}) (err error) {
+
+	row, err := t.tbl.ReadRow(ctx, key)
+	if err != nil {
+		return
+	}
+
+	if len(row) == 0 {
+		err = ErrNotFound
+		return
+	}
+
+	err = readRow(row, t.family, s, t.opts)
+
+	return
+}
+
+// Delete deletes the row of key.
+func (t *Table) Delete(ctx context.Context, key string) (err error) {
+
+	m := bigtable.NewMutation()
+	m.DeleteRow()
+
+	err = t.tbl.Apply(ctx, key, m)
+
+	return
+}
+
+// ReadRows reads the rows of rs into a pointer to a slice of structs, see ReadRows.
+func (t *Table) ReadRows(ctx context.Context, rs bigtable.RowSet, slice interface{}, opts ...bigtable.ReadOption) error {
+	return readRows(ctx, t.tbl, t.family, t.opts, rs, slice, opts...)
+}
+
+// ReadRows reads the rows of rs from tbl and appends them into a pointer to a slice of structs or pointers to structs.
+// Reading stops at the first row failed to convert, the error contains its row key.
+func ReadRows(ctx context.Context, tbl *bigtable.Table, rs bigtable.RowSet, slice interface{}, opts ...bigtable.ReadOption) error {
+	return readRows(ctx, tbl, "", DecodeOptions{}, rs, slice, opts...)
+}
+
+func readRows(ctx context.Context, tbl *bigtable.Table, family string, dopts DecodeOptions, rs bigtable.RowSet, slice interface{}, opts ...bigtable.ReadOption) (err error) {
+
+	sp := reflect.ValueOf(slice)
+	if sp.Kind() != reflect.Ptr || sp.Elem().Kind() != reflect.Slice {
+		err = fmt.Errorf("cloth: slice should be a pointer to slice")
+		return
+	}
+
+	s := sp.Elem()
+	et := s.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+
+	if et.Kind() != reflect.Struct {
+		err = fmt.Errorf("cloth: slice should be a slice of struct, %v", s.Type())
+		return
+	}
+
+	var rerr error
+	err = tbl.ReadRows(ctx, rs, func(row bigtable.Row) bool {
+
+		e := reflect.New(et)
+		if rerr = readRow(row, family, e.Interface(), dopts); rerr != nil {
+			rerr = fmt.Errorf("cloth: row %q: %w", row.Key(), rerr)
+			return false
+		}
+
+		if !isPtr {
+			e = e.Elem()
+		}
+		s.Set(reflect.Append(s, e))
+
+		return true
+	}, opts...)
+
+	if err == nil {
+		err = rerr
+	}
+
+	return
+}
@@ -0,0 +1,184 @@
+package btawel_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/bigtable/bttest"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// newTestTable creates a table with families on an in-memory Bigtable server.
+func newTestTable(t testing.TB, families ...string) (*bigtable.Table, func()) {
+
+	srv, err := bttest.NewServer("localhost:0")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	require.NoError(t, err)
+
+	admin, err := bigtable.NewAdminClient(ctx, "project", "instance", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	defer admin.Close()
+
+	require.NoError(t, admin.CreateTable(ctx, "table"))
+	for _, f := range families {
+		require.NoError(t, admin.CreateColumnFamily(ctx, "table", f))
+	}
+
+	// admin closes its connection
+	conn, err = grpc.Dial(srv.Addr, grpc.WithInsecure())
+	require.NoError(t, err)
+
+	client, err := bigtable.NewClient(ctx, "project", "instance", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+
+	return client.Open("table"), func() {
+		client.Close()
+		srv.Close()
+	}
+}
+
+type User struct {
+	ID        string `bigtable:",rowkey"`
+	Name      string `bigtable:"name"`
+	Email     string `bigtable:"info:email"`
+	Purchased bool   `bigtable:"purchased"`
+	CreatedAt int64  `bigtable:"createdAt"`
+	Address   Address
+}
+
+func TestTable(t *testing.T) {
+
+	tbl, closer := newTestTable(t, "fc", "info", "address")
+	defer closer()
+
+	ctx := context.Background()
+	table := btawel.NewTable(tbl, "fc")
+
+	user := User{
+		ID:        "john",
+		Name:      "John",
+		Email:     "john@example.com",
+		Purchased: true,
+		CreatedAt: 1538352000,
+		Address:   Address{Address: "Rafless st."},
+	}
+
+	t.Run("Put and Get", func(t *testing.T) {
+		require.NoError(t, table.Put(ctx, &user))
+
+		var got User
+		require.NoError(t, table.Get(ctx, user.ID, &got))
+		require.Equal(t, user, got)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		require.NoError(t, table.Update(ctx, &User{ID: user.ID, Name: "Johnny"}, "Name"))
+
+		expected := user
+		expected.Name = "Johnny"
+
+		var got User
+		require.NoError(t, table.Get(ctx, user.ID, &got))
+		require.Equal(t, expected, got)
+	})
+
+	t.Run("Nullable field clears column", func(t *testing.T) {
+		type Nickname struct {
+			ID       string `bigtable:",rowkey"`
+			Nickname string `bigtable:"nickname, nullable"`
+		}
+
+		require.NoError(t, table.Put(ctx, &Nickname{ID: user.ID, Nickname: "Johnny"}))
+		require.NoError(t, table.Put(ctx, &Nickname{ID: user.ID}))
+
+		row, err := tbl.ReadRow(ctx, user.ID)
+		require.NoError(t, err)
+		for _, ri := range row["fc"] {
+			require.NotEqual(t, "fc:nickname", ri.Column)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, table.Delete(ctx, user.ID))
+
+		var got User
+		require.Equal(t, btawel.ErrNotFound, table.Get(ctx, user.ID, &got))
+	})
+
+	t.Run("Error if rowkey is empty", func(t *testing.T) {
+		require.Error(t, table.Put(ctx, &User{Name: "John"}))
+	})
+
+	t.Run("Error if rowkey is not found", func(t *testing.T) {
+		require.Error(t, table.Put(ctx, &Person{Name: "John"}))
+	})
+}
+
+func TestReadRows(t *testing.T) {
+
+	tbl, closer := newTestTable(t, "fc", "info", "address")
+	defer closer()
+
+	ctx := context.Background()
+	table := btawel.NewTable(tbl, "fc")
+
+	users := []User{
+		User{ID: "user#1", Name: "John", Address: Address{Address: "Rafless st."}},
+		User{ID: "user#2", Name: "Jane"},
+		User{ID: "user#3", Name: "Jack"},
+	}
+	for i := range users {
+		require.NoError(t, table.Put(ctx, &users[i]))
+	}
+
+	t.Run("Slice of struct", func(t *testing.T) {
+		var got []User
+		err := table.ReadRows(ctx, bigtable.PrefixRange("user#"), &got)
+
+		require.NoError(t, err)
+		require.Equal(t, users, got)
+	})
+
+	t.Run("Slice of pointer", func(t *testing.T) {
+		var got []*User
+		err := table.ReadRows(ctx, bigtable.NewRange("user#2", ""), &got, bigtable.LimitRows(1))
+
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, users[1], *got[0])
+	})
+
+	t.Run("Family-qualified tags without Table", func(t *testing.T) {
+		var got []Person
+		err := btawel.ReadRows(ctx, tbl, bigtable.PrefixRange("user#"), &got)
+
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		require.Equal(t, "Rafless st.", got[0].Address.Address)
+	})
+
+	t.Run("Error contains the row key", func(t *testing.T) {
+		var got []struct {
+			Name int64 `bigtable:"name"`
+		}
+		err := table.ReadRows(ctx, bigtable.PrefixRange("user#"), &got)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"user#1"`)
+		require.Len(t, got, 0)
+	})
+
+	t.Run("Error if slice isn't a pointer", func(t *testing.T) {
+		var got []User
+		require.Error(t, table.ReadRows(ctx, bigtable.PrefixRange("user#"), got))
+	})
+}
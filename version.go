@@ -0,0 +1,218 @@
+package btawel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+)
+
+var bigtableTimestampType = reflect.TypeOf(bigtable.Timestamp(0))
+
+// versionFields returns the Timestamp and the Value field of a struct type of the elements of a field tagged as versions.
+// The type of Timestamp should be bigtable.Timestamp or time.Time,
+// and neither field should be promoted through an embedded pointer.
+func versionFields(t reflect.Type) (ts, val reflect.StructField, err error) {
+
+	if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Struct {
+		err = fmt.Errorf("cloth: versions should be a slice of struct. %v", t)
+		return
+	}
+
+	var ok bool
+
+	ts, ok = t.Elem().FieldByName("Timestamp")
+	if !ok || ts.Type != bigtableTimestampType && ts.Type != timeType {
+		err = fmt.Errorf("cloth: %v should have Timestamp of bigtable.Timestamp or time.Time", t.Elem())
+		return
+	}
+
+	val, ok = t.Elem().FieldByName("Value")
+	if !ok {
+		err = fmt.Errorf("cloth: %v should have Value", t.Elem())
+		return
+	}
+
+	for _, f := range []reflect.StructField{ts, val} {
+		if throughPointer(t.Elem(), f.Index) {
+			err = fmt.Errorf("cloth: %v should not have %s through an embedded pointer", t.Elem(), f.Name)
+			return
+		}
+	}
+
+	return
+}
+
+// throughPointer reports whether the field of a struct type at index is promoted through an embedded pointer.
+func throughPointer(t reflect.Type, index []int) bool {
+
+	for _, i := range index[:len(index)-1] {
+		if t = t.Field(i).Type; t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setVersionColumns sets a version of a column for each element of a field tagged as versions.
+// t is used for the elements without Timestamp.
+func setVersionColumns(family, qualifier string, t time.Time, m *bigtable.Mutation, sv reflect.Value, ti TagInfo) (err error) {
+
+	tsf, valf, err := versionFields(sv.Type())
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < sv.Len(); i++ {
+
+		e := sv.Index(i)
+
+		ts := bigtable.Time(t)
+		switch tv := e.FieldByIndex(tsf.Index).Interface().(type) {
+		case bigtable.Timestamp:
+			if tv != 0 {
+				ts = tv
+			}
+		case time.Time:
+			if !tv.IsZero() {
+				ts = bigtable.Time(tv)
+			}
+		}
+
+		var b []byte
+		if b, err = getBytes(e.FieldByIndex(valf.Index), ti); err != nil {
+			return
+		}
+
+		m.Set(family, qualifier, ts, b)
+	}
+
+	return
+}
+
+// setVersionsValue sets the versions of a column into a field tagged as versions, the newest first.
+func setVersionsValue(fv reflect.Value, ti TagInfo, ris []bigtable.ReadItem) (err error) {
+
+	st := fv.Type()
+
+	tsf, valf, err := versionFields(st)
+	if err != nil || len(ris) == 0 {
+		return
+	}
+
+	ris = append([]bigtable.ReadItem(nil), ris...)
+	sort.SliceStable(ris, func(i, j int) bool {
+		return ris[i].Timestamp > ris[j].Timestamp
+	})
+
+	sv := reflect.MakeSlice(st, len(ris), len(ris))
+	for i, ri := range ris {
+
+		e := sv.Index(i)
+
+		if tsf.Type == timeType {
+			e.FieldByIndex(tsf.Index).Set(reflect.ValueOf(ri.Timestamp.Time()))
+		} else {
+			e.FieldByIndex(tsf.Index).Set(reflect.ValueOf(ri.Timestamp))
+		}
+
+		if err = decodeValue(e.FieldByIndex(valf.Index), ti, ri.Value); err != nil {
+			return
+		}
+	}
+
+	fv.Set(sv)
+
+	return
+}
+
+// readVersions sets the fields tagged as versions from all versions of ris.
+func readVersions(ris []bigtable.ReadItem, v reflect.Value, p *structPlan, d *decoder) (err error) {
+
+	for _, f := range p.versions {
+
+		var vs []bigtable.ReadItem
+		for _, ri := range ris {
+			if matchColumn(ri.Column, f.ti) {
+				vs = append(vs, ri)
+			}
+		}
+
+		if err = d.decode(f, f.ti.Column, vs, func() error {
+			return setVersionsValue(fieldFor(v, f, vs), f.ti, vs)
+		}); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// latestItems returns the newest version of each column of ris.
+func latestItems(ris []bigtable.ReadItem) []bigtable.ReadItem {
+
+	idx := map[string]int{}
+	ret := make([]bigtable.ReadItem, 0, len(ris))
+
+	for _, ri := range ris {
+
+		i, ok := idx[ri.Column]
+		if !ok {
+			idx[ri.Column] = len(ret)
+			ret = append(ret, ri)
+			continue
+		}
+
+		if ri.Timestamp > ret[i].Timestamp {
+			ret[i] = ri
+		}
+	}
+
+	return ret
+}
+
+// getTimestamp gets the timestamp of a column from the timestamp field fv, def if it is zero.
+func getTimestamp(fv reflect.Value, def bigtable.Timestamp) (ts bigtable.Timestamp, err error) {
+
+	ts = def
+
+	switch v := fv.Interface().(type) {
+	case time.Time:
+		if !v.IsZero() {
+			ts = bigtable.Time(v)
+		}
+	case *time.Time:
+		if v != nil && !v.IsZero() {
+			ts = bigtable.Time(*v)
+		}
+	case bigtable.Timestamp:
+		if v != 0 {
+			ts = v
+		}
+	default:
+		err = fmt.Errorf("cloth: unsupported timestamp type. %v", fv.Kind())
+	}
+
+	return
+}
+
+// setTimestamp sets the timestamp of a column into the timestamp field fv.
+func setTimestamp(fv reflect.Value, ts bigtable.Timestamp) (err error) {
+
+	switch fv.Interface().(type) {
+	case time.Time:
+		fv.Set(reflect.ValueOf(ts.Time()))
+	case *time.Time:
+		t := ts.Time()
+		fv.Set(reflect.ValueOf(&t))
+	case bigtable.Timestamp:
+		fv.Set(reflect.ValueOf(ts))
+	default:
+		err = fmt.Errorf("cloth: unsupported timestamp type. %v", fv.Kind())
+	}
+
+	return
+}
@@ -0,0 +1,232 @@
+package btawel_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/stretchr/testify/require"
+	"github.com/tvlk-data/btawel"
+)
+
+type PriceVersion struct {
+	Timestamp bigtable.Timestamp
+	Value     float64
+}
+
+type NameVersion struct {
+	Timestamp time.Time
+	Value     string
+}
+
+type Product struct {
+	ID     string         `bigtable:",rowkey"`
+	Name   string         `bigtable:"fc:name"`
+	Names  []NameVersion  `bigtable:"fc:name, versions"`
+	Price  float64        `bigtable:"fc:price, omitempty"`
+	Prices []PriceVersion `bigtable:"fc:price, versions"`
+}
+
+func float64Bytes(f float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	return b
+}
+
+func TestReadVersions(t *testing.T) {
+
+	// the oldest first to check the order doesn't matter
+	ris := []bigtable.ReadItem{
+		bigtable.ReadItem{Row: "p", Column: "fc:name", Timestamp: 1000, Value: []byte("old")},
+		bigtable.ReadItem{Row: "p", Column: "fc:name", Timestamp: 3000, Value: []byte("new")},
+		bigtable.ReadItem{Row: "p", Column: "fc:price", Timestamp: 1000, Value: float64Bytes(1)},
+		bigtable.ReadItem{Row: "p", Column: "fc:price", Timestamp: 3000, Value: float64Bytes(3)},
+		bigtable.ReadItem{Row: "p", Column: "fc:price", Timestamp: 2000, Value: float64Bytes(2)},
+	}
+
+	expected := Product{
+		ID:   "p",
+		Name: "new",
+		Names: []NameVersion{
+			{Timestamp: bigtable.Timestamp(3000).Time(), Value: "new"},
+			{Timestamp: bigtable.Timestamp(1000).Time(), Value: "old"},
+		},
+		Price: 3,
+		Prices: []PriceVersion{
+			{Timestamp: 3000, Value: 3},
+			{Timestamp: 2000, Value: 2},
+			{Timestamp: 1000, Value: 1},
+		},
+	}
+
+	t.Run("ReadRow", func(t *testing.T) {
+		var p Product
+		err := btawel.ReadRow(bigtable.Row{"fc": ris}, &p)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, p)
+	})
+
+	t.Run("ReadItems", func(t *testing.T) {
+		var p Product
+		err := btawel.ReadItems(ris, &p)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, p)
+	})
+
+	t.Run("Map gets the newest version", func(t *testing.T) {
+		var s struct {
+			Names map[string]string `bigtable:"fc:nam*"`
+		}
+		require.NoError(t, btawel.ReadRow(bigtable.Row{"fc": ris}, &s))
+		require.Equal(t, map[string]string{"e": "new"}, s.Names)
+
+		s.Names = nil
+		require.NoError(t, btawel.ReadItems(ris, &s))
+		require.Equal(t, map[string]string{"e": "new"}, s.Names)
+	})
+
+	t.Run("Error if versions isn't a slice of version", func(t *testing.T) {
+		var s struct {
+			Prices []float64 `bigtable:"fc:price, versions"`
+		}
+		require.Error(t, btawel.ReadRow(bigtable.Row{"fc": ris}, &s))
+	})
+
+	t.Run("Error if version doesn't have Value", func(t *testing.T) {
+		var s struct {
+			Prices []struct{ Timestamp time.Time } `bigtable:"fc:price, versions"`
+		}
+		require.Error(t, btawel.ReadItems(ris, &s))
+	})
+
+	t.Run("Error if Timestamp is through embedded pointer", func(t *testing.T) {
+		type Stamp struct {
+			Timestamp time.Time
+		}
+		type StampedPrice struct {
+			*Stamp
+			Value float64
+		}
+		var s struct {
+			Prices []StampedPrice `bigtable:"fc:price, versions"`
+		}
+		require.Error(t, btawel.ReadItems(ris, &s))
+
+		s.Prices = []StampedPrice{{Value: 1}}
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+		require.Error(t, err)
+	})
+}
+
+func TestVersionsRoundTrip(t *testing.T) {
+
+	tbl, closer := newTestTable(t, "fc")
+	defer closer()
+
+	ctx := context.Background()
+	table := btawel.NewTable(tbl, "")
+
+	p := Product{
+		ID:   "p",
+		Name: "new",
+		Prices: []PriceVersion{
+			{Timestamp: 3000, Value: 3},
+			{Timestamp: 1000, Value: 1},
+		},
+	}
+
+	m, err := btawel.GenerateColumnsMutation("", time.Unix(0, 2000*1000), &p)
+	require.NoError(t, err)
+	require.Len(t, applyMutations(t, "p", m)["fc"], 3)
+
+	require.NoError(t, table.Put(ctx, &p))
+
+	var got Product
+	require.NoError(t, table.Get(ctx, "p", &got))
+	require.Equal(t, p.Prices, got.Prices)
+	require.Equal(t, float64(3), got.Price)
+	require.Equal(t, "new", got.Name)
+	require.Len(t, got.Names, 1)
+}
+
+type Contact struct {
+	ID             string             `bigtable:",rowkey"`
+	Name           string             `bigtable:"fc:name, ts=NameUpdatedAt"`
+	NameUpdatedAt  time.Time          `bigtable:"-"`
+	Email          string             `bigtable:"fc:email, ts=EmailUpdatedAt"`
+	EmailUpdatedAt bigtable.Timestamp `bigtable:"-"`
+	Bio            string             `bigtable:"fc:bio, ts=BioUpdatedAt"`
+	BioUpdatedAt   *time.Time
+}
+
+func TestTimestampField(t *testing.T) {
+
+	ris := []bigtable.ReadItem{
+		bigtable.ReadItem{Row: "p", Column: "fc:name", Timestamp: 1000, Value: []byte("John")},
+		bigtable.ReadItem{Row: "p", Column: "fc:email", Timestamp: 2000, Value: []byte("john@example.com")},
+		bigtable.ReadItem{Row: "p", Column: "fc:bio", Timestamp: 3000, Value: []byte("WRYYY!")},
+	}
+
+	check := func(t *testing.T, p Contact) {
+		require.Equal(t, "John", p.Name)
+		require.True(t, bigtable.Timestamp(1000).Time().Equal(p.NameUpdatedAt))
+		require.Equal(t, bigtable.Timestamp(2000), p.EmailUpdatedAt)
+		require.True(t, bigtable.Timestamp(3000).Time().Equal(*p.BioUpdatedAt))
+	}
+
+	t.Run("ReadRow", func(t *testing.T) {
+		var p Contact
+		require.NoError(t, btawel.ReadRow(bigtable.Row{"fc": ris}, &p))
+		check(t, p)
+	})
+
+	t.Run("ReadItems", func(t *testing.T) {
+		var p Contact
+		require.NoError(t, btawel.ReadItems(ris, &p))
+		check(t, p)
+	})
+
+	t.Run("Encode", func(t *testing.T) {
+		p := Contact{
+			ID:             "p",
+			Name:           "John",
+			NameUpdatedAt:  bigtable.Timestamp(1000).Time(),
+			Email:          "john@example.com",
+			EmailUpdatedAt: 2000,
+			Bio:            "WRYYY!",
+		}
+
+		m, err := btawel.GenerateColumnsMutation("", bigtable.Timestamp(9000).Time(), &p)
+		require.NoError(t, err)
+
+		ts := map[string]bigtable.Timestamp{}
+		for _, ri := range applyMutations(t, "john", m)["fc"] {
+			ts[ri.Column] = ri.Timestamp
+		}
+		require.Equal(t, map[string]bigtable.Timestamp{"fc:name": 1000, "fc:email": 2000, "fc:bio": 9000}, ts)
+	})
+
+	t.Run("Error if timestamp field is not found", func(t *testing.T) {
+		var s struct {
+			Name string `bigtable:"fc:name, ts=Unknown"`
+		}
+		require.Error(t, btawel.ReadRow(bigtable.Row{"fc": ris}, &s))
+
+		_, err := btawel.GenerateColumnsMutation("", time.Now(), &s)
+		require.Error(t, err)
+	})
+
+	t.Run("Error if timestamp field is unsupported type", func(t *testing.T) {
+		var s struct {
+			Name      string `bigtable:"fc:name, ts=UpdatedAt"`
+			UpdatedAt int64
+		}
+		require.Error(t, btawel.ReadItems(ris, &s))
+	})
+}